@@ -29,7 +29,7 @@ func Init() error {
 	}
 	db = gdb
 
-	if err := db.AutoMigrate(&model.User{}, &model.MLModel{}, &model.DataSource{}, &model.LogQueryHistory{}, &model.LogMonitor{}, &model.NotificationChannel{}); err != nil {
+	if err := db.AutoMigrate(&model.User{}, &model.MLModel{}, &model.DataSource{}, &model.LogQueryHistory{}, &model.LogMonitor{}, &model.NotificationChannel{}, &model.AIConversation{}, &model.AIMessage{}, &model.AIAnalysis{}, &model.AIUsage{}, &model.AIBudget{}, &model.AIRedaction{}, &model.KnowledgeDoc{}, &model.KnowledgeChunk{}, &model.KnowledgeTerm{}, &model.MonitorRun{}, &model.Alert{}, &model.Silence{}, &model.MonitorRoute{}); err != nil {
 		return err
 	}
 
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -21,6 +23,34 @@ func NewAIHandler() *AIHandler {
 type analyzeLogsReq struct {
 	Prompt string        `json:"prompt"`
 	Logs   []interface{} `json:"logs"`
+	// ConversationID continues an existing conversation; 0 starts a new one
+	ConversationID uint `json:"conversationId"`
+	// Role names an analysis persona (see GET /ai/roles); the rest fill its prompt template
+	Role       string `json:"role"`
+	Query      string `json:"query"`
+	Datasource string `json:"datasource"`
+	TimeRange  string `json:"timeRange"`
+	// DatasourceID selects the datasource's custom redaction rules
+	DatasourceID string `json:"datasourceId"`
+}
+
+func (r analyzeLogsReq) converse(c *gin.Context) service.ConverseRequest {
+	return service.ConverseRequest{UserID: currentUserID(c), ConversationID: r.ConversationID, AnalysisInput: service.AnalysisInput{
+		Role: r.Role, Prompt: r.Prompt, Logs: r.Logs, Query: r.Query, Datasource: r.Datasource, DatasourceID: r.DatasourceID, TimeRange: r.TimeRange,
+	}}
+}
+
+// currentUserID returns the authenticated user id set by AuthRequired, 0 if unknown
+func currentUserID(c *gin.Context) uint {
+	uid, _ := c.Get("userId")
+	switch v := uid.(type) {
+	case uint:
+		return v
+	case string:
+		n, _ := strconv.ParseUint(v, 10, 64)
+		return uint(n)
+	}
+	return 0
 }
 
 // AnalyzeLogs uses the default enabled model to analyze provided logs with a user prompt
@@ -31,11 +61,178 @@ func (h *AIHandler) AnalyzeLogs(c *gin.Context) {
 		return
 	}
 
-	reply, err := h.aiService.Analyze(req.Prompt, req.Logs)
+	conv, reply, err := h.aiService.Converse(c.Request.Context(), req.converse(c), nil)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"reply": reply.Content, "citations": reply.Citations, "conversationId": conv.ID, "model": conv.ModelName}})
+}
+
+// AnalyzeLogsStream is the streaming variant of AnalyzeLogs. The reply is sent
+// as server-sent events: "delta" events carry content fragments, a final "done"
+// event the whole reply, its knowledge base citations, the conversation id and
+// the model that answered. The upstream request is cancelled when the client
+// leaves.
+func (h *AIHandler) AnalyzeLogsStream(c *gin.Context) {
+	var req analyzeLogsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "bad request"})
+		return
+	}
+
+	// Analyses can outlive the server write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	conv, reply, err := h.aiService.Converse(ctx, req.converse(c), func(delta string) error {
+		c.SSEvent("delta", gin.H{"content": delta})
+		c.Writer.Flush()
+		return ctx.Err()
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		data := gin.H{"message": err.Error()}
+		if conv != nil {
+			data["conversationId"] = conv.ID
+		}
+		c.SSEvent("error", data)
+		c.Writer.Flush()
+		return
+	}
+	c.SSEvent("done", gin.H{"reply": reply.Content, "citations": reply.Citations, "conversationId": conv.ID, "model": conv.ModelName})
+	c.Writer.Flush()
+}
+
+type generateQueryReq struct {
+	Engine       string `json:"engine"`
+	DatasourceID string `json:"datasourceId"`
+	Request      string `json:"request"`
+}
+
+// GenerateQuery turns a plain-language request into a query for the selected engine
+func (h *AIHandler) GenerateQuery(c *gin.Context) {
+	var req generateQueryReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Engine == "" || req.Request == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "engine and request are required"})
+		return
+	}
+
+	ctx := service.WithUsageScope(c.Request.Context(), service.UsageScope{UserID: currentUserID(c)})
+	result, err := h.aiService.GenerateQuery(ctx, req.Engine, req.DatasourceID, req.Request)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": result})
+}
+
+// AnalyzeLogsStructured returns and stores a structured analysis (severity,
+// affected services, root cause, evidence rows, actions). Evidence lines index
+// the posted logs.
+func (h *AIHandler) AnalyzeLogsStructured(c *gin.Context) {
+	var req analyzeLogsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "bad request"})
+		return
+	}
+	rec, err := h.aiService.AnalyzeStructured(c.Request.Context(), req.converse(c).AnalysisInput, currentUserID(c), 0)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"item": rec}})
+}
+
+// ListAnalyses lists stored structured analyses, filtered by monitorId and severity
+func (h *AIHandler) ListAnalyses(c *gin.Context) {
+	monitorID, _ := strconv.ParseUint(c.Query("monitorId"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	items, err := h.aiService.ListAnalyses(uint(monitorID), c.Query("severity"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+// GetAnalysis returns one stored structured analysis
+func (h *AIHandler) GetAnalysis(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	rec, err := h.aiService.GetAnalysis(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"item": rec}})
+}
+
+// ListRoles lists the analysis roles: the built-in one and those defined on the models
+func (h *AIHandler) ListRoles(c *gin.Context) {
+	items, err := h.aiService.Roles()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 500, "message": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+// ListConversations lists the current user's analysis conversations
+func (h *AIHandler) ListConversations(c *gin.Context) {
+	items, err := h.aiService.ListConversations(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+// GetConversation returns a conversation with its messages and log snapshot, used to resume it
+func (h *AIHandler) GetConversation(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	conv, logs, err := h.aiService.GetConversation(currentUserID(c), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"item": conv, "logs": logs}})
+}
+
+type renameConversationReq struct {
+	Title string `json:"title"`
+}
+
+// RenameConversation changes a conversation title
+func (h *AIHandler) RenameConversation(c *gin.Context) {
+	var req renameConversationReq
+	if err := c.ShouldBindJSON(&req); err != nil || req.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "title is required"})
+		return
+	}
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := h.aiService.RenameConversation(currentUserID(c), uint(id), req.Title); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+}
 
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"reply": reply}})
+// DeleteConversation removes a conversation and its messages
+func (h *AIHandler) DeleteConversation(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := h.aiService.DeleteConversation(currentUserID(c), uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
 }
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListRedactions lists the redaction audit trail, filtered by userId and monitorId
+func (h *AIHandler) ListRedactions(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Query("userId"), 10, 64)
+	monitorID, _ := strconv.ParseUint(c.Query("monitorId"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	items, err := h.aiService.ListRedactions(uint(userID), uint(monitorID), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+type previewRedactionReq struct {
+	Text  string      `json:"text"`
+	Rules interface{} `json:"rules"`
+}
+
+// PreviewRedaction shows what would be sent to a model for text, with the
+// built-in detectors and the given custom rules
+func (h *AIHandler) PreviewRedaction(c *gin.Context) {
+	var req previewRedactionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "bad request"})
+		return
+	}
+	text, findings, err := h.aiService.PreviewRedaction(req.Text, req.Rules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"text": text, "findings": findings}})
+}
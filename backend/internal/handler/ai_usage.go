@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+	"ailap-backend/internal/service"
+)
+
+// parseUsageTime accepts RFC3339 or a plain date
+func parseUsageTime(v string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// UsageSummary aggregates token usage and cost between from and to (default:
+// this month), grouped by model, user, monitor, feature or day
+func (h *AIHandler) UsageSummary(c *gin.Context) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := now
+	if v := c.Query("from"); v != "" {
+		t, ok := parseUsageTime(v)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "invalid from"})
+			return
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, ok := parseUsageTime(v)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "invalid to"})
+			return
+		}
+		to = t
+	}
+	groupBy := c.DefaultQuery("groupBy", "model")
+	items, total, err := h.aiService.UsageSummary(from, to, groupBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items, "total": total, "from": from, "to": to}})
+}
+
+// ListUsage lists the latest AI calls, filtered by userId, modelId and monitorId
+func (h *AIHandler) ListUsage(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Query("userId"), 10, 64)
+	modelID, _ := strconv.ParseUint(c.Query("modelId"), 10, 64)
+	monitorID, _ := strconv.ParseUint(c.Query("monitorId"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	items, err := h.aiService.ListUsage(uint(userID), uint(modelID), uint(monitorID), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+// ListBudgets lists the cost budgets with what was spent in the current period
+func (h *AIHandler) ListBudgets(c *gin.Context) {
+	items, err := h.aiService.ListBudgets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+func (h *AIHandler) CreateBudget(c *gin.Context) {
+	var b model.AIBudget
+	if err := c.ShouldBindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "bad request"})
+		return
+	}
+	if err := service.ValidateBudget(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	b.ID = 0
+	enabled := b.Enabled
+	if err := database.GetDB().Create(&b).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	// Create skips the zero value and applies the column default
+	if !enabled {
+		database.GetDB().Model(&b).Update("enabled", false)
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"id": b.ID}})
+}
+
+func (h *AIHandler) UpdateBudget(c *gin.Context) {
+	var b model.AIBudget
+	if err := c.ShouldBindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "bad request"})
+		return
+	}
+	if err := service.ValidateBudget(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	id := c.Param("id")
+	res := database.GetDB().Model(&model.AIBudget{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name": b.Name, "scope": b.Scope, "scope_id": b.ScopeID, "period": b.Period,
+		"max_cost": b.MaxCost, "action": b.Action, "enabled": b.Enabled,
+	})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+}
+
+func (h *AIHandler) DeleteBudget(c *gin.Context) {
+	id := c.Param("id")
+	database.GetDB().Delete(&model.AIBudget{}, "id = ?", id)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+}
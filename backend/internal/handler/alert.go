@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+	"ailap-backend/internal/service"
+)
+
+// ---- Alerts ----
+
+// ListAlerts lists alerts, newest first, filtered by status and monitor
+func (h *MonitorHandler) ListAlerts(c *gin.Context) {
+	monitorID, _ := strconv.ParseUint(c.Query("monitorId"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	items, err := h.svc.ListAlerts(c.Query("status"), uint(monitorID), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+// AckAlert acknowledges a firing alert, stopping its repeat notifications
+func (h *MonitorHandler) AckAlert(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	item, err := h.svc.AcknowledgeAlert(uint(id), currentUserID(c))
+	if errors.Is(err, service.ErrAlertState) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "only firing alerts can be acknowledged"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"item": item}})
+}
+
+// ---- Silences ----
+
+// ListSilences lists active and pending silences, or every silence with all=true
+func (h *MonitorHandler) ListSilences(c *gin.Context) {
+	items, err := h.svc.ListSilences(c.Query("all") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+func (h *MonitorHandler) CreateSilence(c *gin.Context) {
+	var req model.Silence
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	req.ID = 0
+	req.CreatedBy = currentUserID(c)
+	if err := service.ValidateSilence(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := database.GetDB().Create(&req).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"item": req}})
+}
+
+// ExpireSilence ends a silence now; it is kept for the record
+func (h *MonitorHandler) ExpireSilence(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := h.svc.ExpireSilence(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+}
@@ -1,34 +1,25 @@
 package handler
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
-	"io"
 	"net/http"
-	"net/url"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"ailap-backend/internal/database"
 	"ailap-backend/internal/model"
+	"ailap-backend/internal/service"
 	"ailap-backend/internal/utils"
 )
 
-// hasPath reports whether the provided endpoint already contains a non-root path
-func hasPath(raw string) bool {
-	u, err := url.Parse(raw)
-	if err != nil {
-		return false
-	}
-	return u.Path != "" && u.Path != "/"
+type DataSourcesHandler struct {
+	logService *service.LogService
 }
 
-type DataSourcesHandler struct{}
-
-func NewDataSourcesHandler() *DataSourcesHandler { return &DataSourcesHandler{} }
+func NewDataSourcesHandler() *DataSourcesHandler {
+	return &DataSourcesHandler{logService: service.NewLogService()}
+}
 
 func (h *DataSourcesHandler) List(c *gin.Context) {
 	var items []model.DataSource
@@ -53,6 +44,10 @@ func (h *DataSourcesHandler) Create(c *gin.Context) {
 		c.JSON(400, gin.H{"code": 400, "message": "name and endpoint are required"})
 		return
 	}
+	if err := service.ValidateRedactionRules(raw["redactionRules"]); err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
 
 	cfgBytes, _ := json.Marshal(raw)
 	d := model.DataSource{
@@ -82,6 +77,10 @@ func (h *DataSourcesHandler) Update(c *gin.Context) {
 		c.JSON(400, gin.H{"code": 400, "message": "name and endpoint are required"})
 		return
 	}
+	if err := service.ValidateRedactionRules(raw["redactionRules"]); err != nil {
+		c.JSON(400, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
 
 	cfgBytes, _ := json.Marshal(raw)
 	updates := map[string]interface{}{
@@ -136,103 +135,23 @@ func (h *DataSourcesHandler) Test(c *gin.Context) {
 		}
 	}
 	typ := stringOr(raw["type"])
-	endpoint := stringOr(raw["endpoint"])
-	client := createTestHTTPClient(raw, 5*time.Second)
-	reqURL := endpoint
-	if typ == "loki" {
-		if !hasPath(endpoint) {
-			reqURL = endpoint + "/loki/api/v1/labels?limit=1"
-		}
-	} else if typ == "elasticsearch" {
-		if !hasPath(endpoint) {
-			reqURL = endpoint + "/_cluster/health"
-		}
-	}
-	req, _ := http.NewRequest(http.MethodGet, reqURL, nil)
-	if token := stringOr(raw["token"]); token != "" {
-		req.Header.Set("Authorization", "Bearer "+token)
-	}
-	if apiKey := stringOr(raw["apiKey"]); apiKey != "" {
-		req.Header.Set("Authorization", "ApiKey "+apiKey)
-	}
-	if username := stringOr(raw["username"]); username != "" {
-		if password := stringOr(raw["password"]); password != "" {
-			req.SetBasicAuth(username, password)
-		}
+	ds := &service.Datasource{
+		Model:    model.DataSource{Name: stringOr(raw["name"]), Type: typ, Endpoint: stringOr(raw["endpoint"])},
+		Config:   raw,
+		Endpoint: stringOr(raw["endpoint"]),
 	}
-	resp, err := client.Do(req)
+	result, err := h.logService.TestConnection(c.Request.Context(), ds)
 	if err != nil {
-		utils.GetLogger().Error("test datasource", zap.String("type", typ), zap.String("url", reqURL), zap.Error(err))
+		utils.GetLogger().Error("test datasource", zap.String("type", typ), zap.String("endpoint", ds.Endpoint), zap.Error(err))
 		c.JSON(200, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	utils.GetLogger().Info("test datasource", zap.String("type", typ), zap.String("url", reqURL), zap.Int("status", resp.StatusCode))
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		c.JSON(200, gin.H{"code": 0, "message": "ok", "data": gin.H{"status": resp.Status, "body": string(body)}})
+	utils.GetLogger().Info("test datasource", zap.String("type", typ), zap.String("url", result.URL), zap.Int("status", result.StatusCode))
+	if result.OK() {
+		c.JSON(200, gin.H{"code": 0, "message": "ok", "data": gin.H{"status": result.Status, "body": result.Body}})
 		return
 	}
-	c.JSON(200, gin.H{"code": 1, "message": resp.Status, "data": gin.H{"body": string(body)}})
-}
-
-// createTestHTTPClient creates an HTTP client with TLS configuration for testing
-func createTestHTTPClient(cfg map[string]interface{}, timeout time.Duration) *http.Client {
-	transport := &http.Transport{}
-
-	// TLS configuration
-	if tlsCfg := getTestTLSConfig(cfg); tlsCfg != nil {
-		transport.TLSClientConfig = tlsCfg
-	}
-
-	return &http.Client{
-		Transport: transport,
-		Timeout:   timeout,
-	}
-}
-
-// getTestTLSConfig extracts TLS configuration from datasource config for testing
-func getTestTLSConfig(cfg map[string]interface{}) *tls.Config {
-	if cfg == nil {
-		return nil
-	}
-
-	tlsData, ok := cfg["tls"].(map[string]interface{})
-	if !ok {
-		return nil
-	}
-
-	tlsConfig := &tls.Config{}
-
-	// Skip certificate verification
-	if skipVerify, ok := tlsData["skipVerify"].(bool); ok && skipVerify {
-		tlsConfig.InsecureSkipVerify = true
-	}
-
-	// Server name for TLS
-	if serverName, ok := tlsData["serverName"].(string); ok && serverName != "" {
-		tlsConfig.ServerName = serverName
-	}
-
-	// CA certificate for self-signed certificates
-	if caCert, ok := tlsData["caCert"].(string); ok && caCert != "" {
-		caCertPool := x509.NewCertPool()
-		if caCertPool.AppendCertsFromPEM([]byte(caCert)) {
-			tlsConfig.RootCAs = caCertPool
-		}
-	}
-
-	// Client certificate authentication
-	if clientCert, ok := tlsData["clientCert"].(string); ok && clientCert != "" {
-		if clientKey, ok := tlsData["clientKey"].(string); ok && clientKey != "" {
-			cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
-			if err == nil {
-				tlsConfig.Certificates = []tls.Certificate{cert}
-			}
-		}
-	}
-
-	return tlsConfig
+	c.JSON(200, gin.H{"code": 1, "message": result.Status, "data": gin.H{"body": result.Body}})
 }
 
 func stringOr(v interface{}) string {
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"ailap-backend/internal/model"
+)
+
+// maxKnowledgeUpload caps an uploaded document
+const maxKnowledgeUpload = 2 << 20
+
+type knowledgeDocReq struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// bindKnowledgeDoc reads a document from JSON {title, content} or from a
+// multipart "file" upload (markdown or text), titled after the file by default
+func bindKnowledgeDoc(c *gin.Context) (*knowledgeDocReq, bool) {
+	var req knowledgeDocReq
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, false
+		}
+		if fh.Size > maxKnowledgeUpload {
+			return nil, false
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, false
+		}
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return nil, false
+		}
+		req.Content = string(b)
+		req.Title = c.PostForm("title")
+		if req.Title == "" {
+			req.Title = strings.TrimSuffix(fh.Filename, filepath.Ext(fh.Filename))
+		}
+		return &req, true
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, false
+	}
+	return &req, true
+}
+
+// ListKnowledge lists the knowledge base documents, filtered by source (upload, analysis)
+func (h *AIHandler) ListKnowledge(c *gin.Context) {
+	items, err := h.aiService.ListKnowledgeDocs(c.Query("source"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+// GetKnowledge returns a document with its content
+func (h *AIHandler) GetKnowledge(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	doc, err := h.aiService.GetKnowledgeDoc(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"item": doc}})
+}
+
+// CreateKnowledge adds a runbook or markdown document and indexes it
+func (h *AIHandler) CreateKnowledge(c *gin.Context) {
+	req, ok := bindKnowledgeDoc(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "bad request"})
+		return
+	}
+	doc := model.KnowledgeDoc{Title: req.Title, Content: req.Content, CreatedBy: currentUserID(c)}
+	if err := h.aiService.SaveKnowledgeDoc(&doc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"id": doc.ID, "chunks": doc.Chunks}})
+}
+
+// UpdateKnowledge replaces a document's title and content and reindexes it
+func (h *AIHandler) UpdateKnowledge(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	doc, err := h.aiService.GetKnowledgeDoc(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "not found"})
+		return
+	}
+	req, ok := bindKnowledgeDoc(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "bad request"})
+		return
+	}
+	doc.Title, doc.Content = req.Title, req.Content
+	if err := h.aiService.SaveKnowledgeDoc(doc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"id": doc.ID, "chunks": doc.Chunks}})
+}
+
+// DeleteKnowledge removes a document from the knowledge base
+func (h *AIHandler) DeleteKnowledge(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := h.aiService.DeleteKnowledgeDoc(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+}
+
+// SearchKnowledge returns the excerpts an analysis for q would be given
+func (h *AIHandler) SearchKnowledge(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	items, err := h.aiService.SearchKnowledge(c.Query("q"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+type resolveAnalysisReq struct {
+	Resolution string `json:"resolution"`
+}
+
+// ResolveAnalysis stores a structured analysis with its resolution in the
+// knowledge base, so repeat incidents are answered with it
+func (h *AIHandler) ResolveAnalysis(c *gin.Context) {
+	var req resolveAnalysisReq
+	_ = c.ShouldBindJSON(&req)
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	doc, err := h.aiService.ResolveAnalysis(uint(id), currentUserID(c), req.Resolution)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 500, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"id": doc.ID}})
+}
@@ -3,9 +3,8 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -27,68 +26,29 @@ func NewLogsHandler() *LogsHandler {
 	}
 }
 
-// Query proxies logs for different engines (loki, elasticsearch)
+// Query proxies logs for the registered engines (loki, elasticsearch, victorialogs)
 func (h *LogsHandler) Query(c *gin.Context) {
 	engine := c.Query("engine")
-	if engine != "loki" && engine != "elasticsearch" && engine != "victorialogs" {
+	if _, ok := service.GetEngine(engine); !ok {
 		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": []interface{}{}}})
 		return
 	}
 
 	mode := c.Query("mode")
-	queryParam := c.Query("query")
 	lineLimit := c.DefaultQuery("lineLimit", "1000")
 	typ := strings.ToLower(c.DefaultQuery("type", "range"))
 	qStart := c.Query("start")
 	qEnd := c.Query("end")
-	// qStep := c.DefaultQuery("step", "60s")
-	// qDirection := c.DefaultQuery("direction", "BACKWARD")
+	qStep := c.Query("step")
+	qDirection := c.DefaultQuery("direction", "BACKWARD")
+	cursor := c.Query("cursor")
 	datasourceID := c.Query("datasourceId")
 
-	finalQuery := queryParam
-
-	if engine == "loki" {
-		// Build query from builder when needed
-		if mode == "builder" && queryParam == "" {
-			// Manual parsing of nested URL parameters
-			filters := make([]struct {
-				Label, Op string
-				Values    []string
-			}, 0)
-
-			// Parse builder[labelFilters][0][label], builder[labelFilters][0][op], etc.
-			for i := 0; i < 10; i++ { // support up to 10 filters
-				labelKey := fmt.Sprintf("builder[labelFilters][%d][label]", i)
-				opKey := fmt.Sprintf("builder[labelFilters][%d][op]", i)
-				label := c.Query(labelKey)
-				op := c.Query(opKey)
-				if label == "" && op == "" {
-					break
-				}
-
-				var values []string
-				for j := 0; j < 10; j++ { // support up to 10 values per filter
-					valueKey := fmt.Sprintf("builder[labelFilters][%d][values][%d]", i, j)
-					value := c.Query(valueKey)
-					if value == "" {
-						break
-					}
-					values = append(values, value)
-				}
-
-				if label != "" && len(values) > 0 {
-					filters = append(filters, struct {
-						Label, Op string
-						Values    []string
-					}{Label: label, Op: op, Values: values})
-				}
-			}
-
-			contains := c.Query("builder[contains]")
-			finalQuery = buildLokiQuery(filters, contains)
-		}
-	} else if engine == "elasticsearch" {
-		// ES logic handled in service, optional query construction here if needed
+	finalQuery := builderQuery(c, engine)
+	filter, err := queryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
 	}
 
 	// Logic for time range standardization
@@ -107,105 +67,198 @@ func (h *LogsHandler) Query(c *gin.Context) {
 	}
 
 	// Execute via Service
-	result, err := h.logService.ExecuteQuery(c.Request.Context(), engine, datasourceID, finalQuery, start, end, limit)
-
-	// Save history
-	_ = database.GetDB().Create(&model.LogQueryHistory{
-		Engine:    engine,
-		Mode:      mode,
+	result, err := h.logService.ExecuteQuery(c.Request.Context(), engine, datasourceID, service.QueryRequest{
 		Query:     finalQuery,
-		LineLimit: limit,
-	}).Error
+		Start:     start,
+		End:       end,
+		Limit:     limit,
+		Step:      qStep,
+		Direction: qDirection,
+		Cursor:    cursor,
+		Paginate:  true,
+		Filter:    filter,
+	})
+
+	// Save history (only for the first page, not when paging with a cursor)
+	if cursor == "" {
+		_ = database.GetDB().Create(&model.LogQueryHistory{
+			Engine:    engine,
+			Mode:      mode,
+			Query:     finalQuery,
+			LineLimit: limit,
+		}).Error
+	}
 
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 1, "message": err.Error(), "data": gin.H{"items": []interface{}{}}})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": result.Items}})
+	data := gin.H{"items": result.Items, "nextCursor": result.NextCursor}
+	if result.ResultType != "" {
+		data["resultType"] = result.ResultType
+		data["series"] = result.Series
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": data})
 }
 
-// Suggestions returns label names for Loki when engine=loki
-func (h *LogsHandler) Suggestions(c *gin.Context) {
+type federatedQueryReq struct {
+	Sources        []service.FederatedSource `json:"sources"`
+	Start          string                    `json:"start"`
+	End            string                    `json:"end"`
+	LineLimit      int                       `json:"lineLimit"`
+	TimeoutSeconds int                       `json:"timeoutSeconds"`
+}
+
+// FederatedQuery searches several datasources at once and merges rows by time
+// POST /api/logs/federated {"sources":[{"engine":"loki","datasourceId":"1","query":"{app=\"pay\"}"}, ...]}
+func (h *LogsHandler) FederatedQuery(c *gin.Context) {
+	var req federatedQueryReq
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Sources) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "at least one source is required"})
+		return
+	}
+	for _, src := range req.Sources {
+		if _, ok := service.GetEngine(src.Engine); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "unsupported engine: " + src.Engine})
+			return
+		}
+	}
+	if req.LineLimit <= 0 {
+		req.LineLimit = 1000
+	}
+
+	result := h.logService.FederatedQuery(c.Request.Context(), req.Sources, service.QueryRequest{
+		Start: req.Start,
+		End:   req.End,
+		Limit: req.LineLimit,
+	}, time.Duration(req.TimeoutSeconds)*time.Second)
+
+	message := "success"
+	if result.Partial {
+		message = "partial results: some datasources failed"
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": message, "data": result})
+}
+
+// Tail streams new log entries as server-sent events until the client disconnects
+// GET /api/logs/tail?engine=loki&query={app="foo"}[&datasourceId=1]
+func (h *LogsHandler) Tail(c *gin.Context) {
 	engine := c.Query("engine")
-	if engine != "loki" {
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": []interface{}{}}})
+	if _, ok := service.GetEngine(engine); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "unsupported engine"})
 		return
 	}
-	_, cfg, endpoint, ok := service.ResolveLokiDatasource(c.Query("datasourceId"))
-	if !ok {
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "no loki datasource", "data": gin.H{"items": []interface{}{}}})
+	filter, err := queryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
 		return
 	}
-	// Re-implemented logic or just keep as is for metadata functions not yet in service properly
-	u := endpoint
-	if parsed, err := url.Parse(u); err == nil && (parsed.Path == "" || parsed.Path == "/") {
-		u = u + "/loki/api/v1/labels"
+	limit, _ := strconv.Atoi(c.Query("lineLimit"))
+	req := service.QueryRequest{
+		Query:  builderQuery(c, engine),
+		Start:  c.Query("start"),
+		Limit:  limit,
+		Filter: filter,
+	}
+
+	// Tail streams outlive the server write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	err = h.logService.Tail(ctx, engine, c.Query("datasourceId"), req, func(rows []map[string]interface{}) error {
+		c.SSEvent("logs", gin.H{"items": rows})
+		c.Writer.Flush()
+		return ctx.Err()
+	})
+	if err != nil && ctx.Err() == nil {
+		c.SSEvent("error", gin.H{"message": err.Error()})
+		c.Writer.Flush()
 	}
-	req, _ := http.NewRequest(http.MethodGet, u, nil)
-	service.ApplyAuthHeaders(req, cfg)
-	client := service.CreateHTTPClient(cfg, 5*time.Second)
-	resp, err := client.Do(req)
+}
+
+// Volume returns log counts per time bucket and level for the histogram
+// GET /api/logs/volume?engine=loki&query={app="foo"}&start=..&end=..[&step=60s]
+func (h *LogsHandler) Volume(c *gin.Context) {
+	engine := c.Query("engine")
+	filter, err := queryFilter(c)
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": []interface{}{}}})
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
 		return
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": []interface{}{}}})
+	result, err := h.logService.Volume(c.Request.Context(), engine, c.Query("datasourceId"), service.QueryRequest{
+		Query:  builderQuery(c, engine),
+		Start:  c.Query("start"),
+		End:    c.Query("end"),
+		Step:   c.Query("step"),
+		Filter: filter,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 1, "message": err.Error(), "data": gin.H{"series": []interface{}{}}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": result})
+}
+
+// Patterns runs the query and returns the message templates mined from it
+// GET /api/logs/patterns?engine=loki&query={app="foo"}&start=..&end=..[&lineLimit=5000]
+func (h *LogsHandler) Patterns(c *gin.Context) {
+	engine := c.Query("engine")
+	filter, err := queryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
 		return
 	}
-	var obj map[string]interface{}
-	_ = json.Unmarshal(body, &obj)
-	var items []interface{}
-	if d, ok := obj["data"].([]interface{}); ok {
-		items = d
+	limit, _ := strconv.Atoi(c.DefaultQuery("lineLimit", "5000"))
+	start, end := c.Query("start"), c.Query("end")
+	if start == "" || end == "" {
+		now := time.Now()
+		start = fmt.Sprintf("%d", now.Add(-1*time.Hour).UnixNano())
+		end = fmt.Sprintf("%d", now.UnixNano())
+	}
+	patterns, rows, err := h.logService.Patterns(c.Request.Context(), engine, c.Query("datasourceId"), service.QueryRequest{
+		Query:  builderQuery(c, engine),
+		Start:  start,
+		End:    end,
+		Limit:  limit,
+		Filter: filter,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 1, "message": err.Error(), "data": gin.H{"items": []interface{}{}}})
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": patterns, "rows": rows}})
 }
 
-// LabelValues returns values for a specific Loki label
-// GET /api/logs/label-values?engine=loki&label=service_name[&datasourceId=1]
-func (h *LogsHandler) LabelValues(c *gin.Context) {
-	if c.Query("engine") != "loki" {
+// Suggestions returns label / field names of the selected engine
+func (h *LogsHandler) Suggestions(c *gin.Context) {
+	items, err := h.logService.Labels(c.Request.Context(), c.Query("engine"), c.Query("datasourceId"))
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": []interface{}{}}})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
+// LabelValues returns values for a specific label / field
+// GET /api/logs/label-values?engine=loki&label=service_name[&datasourceId=1]
+func (h *LogsHandler) LabelValues(c *gin.Context) {
 	label := c.Query("label")
 	if label == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "label is required"})
 		return
 	}
-	_, cfg, endpoint, ok := service.ResolveLokiDatasource(c.Query("datasourceId"))
-	if !ok {
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "no loki datasource", "data": gin.H{"items": []interface{}{}}})
-		return
-	}
-	u := endpoint
-	if parsed, err := url.Parse(u); err == nil && (parsed.Path == "" || parsed.Path == "/") {
-		u = u + "/loki/api/v1/label/" + url.PathEscape(label) + "/values"
-	}
-	req, _ := http.NewRequest(http.MethodGet, u, nil)
-	service.ApplyAuthHeaders(req, cfg)
-	client := service.CreateHTTPClient(cfg, 5*time.Second)
-	resp, err := client.Do(req)
+	items, err := h.logService.LabelValues(c.Request.Context(), c.Query("engine"), c.Query("datasourceId"), label)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": []interface{}{}}})
 		return
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": []interface{}{}}})
-		return
-	}
-	var obj map[string]interface{}
-	_ = json.Unmarshal(body, &obj)
-	var items []interface{}
-	if d, ok := obj["data"].([]interface{}); ok {
-		items = d
-	}
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
 }
 
@@ -295,161 +348,103 @@ func (h *LogsHandler) DeleteHistory(c *gin.Context) {
 
 // Inspect: loki -> URL; elasticsearch -> {url, body}
 func (h *LogsHandler) Inspect(c *gin.Context) {
-	// Keep Inspect logic here or move to service if deep inspection reuse needed.
-	// For now, simpler to keep handler logic as it constructs potential requests.
-	// Or reuse service's resolve functions.
-
 	engine := c.Query("engine")
-	if engine == "loki" {
-		// ... (existing helper logic)
-		mode := c.Query("mode")
-		query := c.Query("query")
-		if mode == "builder" && query == "" {
-			// ... (construct query) ...
-			filters := make([]struct {
-				Label, Op string
-				Values    []string
-			}, 0)
-			for i := 0; i < 10; i++ {
-				label := c.Query(fmt.Sprintf("builder[labelFilters][%d][label]", i))
-				op := c.Query(fmt.Sprintf("builder[labelFilters][%d][op]", i))
-				if label == "" && op == "" {
-					break
-				}
-				var values []string
-				for j := 0; j < 10; j++ {
-					value := c.Query(fmt.Sprintf("builder[labelFilters][%d][values][%d]", i, j))
-					if value == "" {
-						break
-					}
-					values = append(values, value)
-				}
-				if label != "" && len(values) > 0 {
-					filters = append(filters, struct {
-						Label, Op string
-						Values    []string
-					}{Label: label, Op: op, Values: values})
-				}
-			}
-			contains := c.Query("builder[contains]")
-			query = buildLokiQuery(filters, contains)
-		}
-		_, _, endpoint, ok := service.ResolveLokiDatasource(c.Query("datasourceId"))
-		if !ok {
-			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "no loki datasource", "data": gin.H{"url": ""}})
-			return
-		}
-		params := url.Values{}
-		params.Set("query", query)
-		for _, k := range []string{"start", "end", "step", "direction"} {
-			if v := c.Query(k); v != "" {
-				params.Set(k, v)
-			}
-		}
-		urlStr := endpoint + "/loki/api/v1/query_range?" + params.Encode()
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"url": urlStr}})
+	if engine == "" {
+		engine = "elasticsearch"
+	}
+	filter, err := queryFilter(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error(), "data": gin.H{"url": ""}})
 		return
 	}
-	if engine == "victorialogs" {
-		_, _, endpoint, ok := service.ResolveVictoriaLogsDatasource(c.Query("datasourceId"))
-		if !ok {
-			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "no victorialogs datasource", "data": gin.H{"url": ""}})
-			return
+	result, err := h.logService.Inspect(engine, c.Query("datasourceId"), service.QueryRequest{
+		Query:     builderQuery(c, engine),
+		Start:     c.Query("start"),
+		End:       c.Query("end"),
+		Step:      c.Query("step"),
+		Direction: c.Query("direction"),
+		Filter:    filter,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": err.Error(), "data": gin.H{"url": ""}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": result})
+}
+
+// builderQuery returns the query param, building LogQL from the Loki
+// query builder params when mode=builder and no query was given
+func builderQuery(c *gin.Context, engine string) string {
+	query := c.Query("query")
+	if engine != "loki" || c.Query("mode") != "builder" || query != "" {
+		return query
+	}
+	filter := &service.Filter{}
+	// Parse builder[labelFilters][0][label], builder[labelFilters][0][op], etc.
+	for i := 0; i < 10; i++ { // support up to 10 filters
+		label := c.Query(fmt.Sprintf("builder[labelFilters][%d][label]", i))
+		op := c.Query(fmt.Sprintf("builder[labelFilters][%d][op]", i))
+		if label == "" && op == "" {
+			break
 		}
-		params := url.Values{}
-		params.Set("query", c.Query("query"))
-		if v := c.Query("start"); v != "" {
-			params.Set("start", v)
+
+		var values []string
+		for j := 0; j < 10; j++ { // support up to 10 values per filter
+			value := c.Query(fmt.Sprintf("builder[labelFilters][%d][values][%d]", i, j))
+			if value == "" {
+				break
+			}
+			values = append(values, value)
 		}
-		if v := c.Query("end"); v != "" {
-			params.Set("end", v)
+
+		if label != "" && len(values) > 0 {
+			filter.And(builderLabelFilter(label, op, values))
 		}
-		urlStr := endpoint + "/select/logsql/query?" + params.Encode()
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"url": urlStr}})
-		return
 	}
-	// ES inspect
-	_, cfg, endpoint, ok := service.ResolveElasticsearchDatasource(c.Query("datasourceId"))
-	if !ok {
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "no elasticsearch datasource", "data": gin.H{"url": "", "body": ""}})
-		return
+	if contains := c.Query("builder[contains]"); contains != "" {
+		filter.And(service.FilterNode{Op: service.FilterContains, Value: contains})
 	}
-	// ... (ES Inspect Logic kept mostly same, employing Resolve helper) ...
-	indexPath := ""
-	if es, ok := cfg["es"].(map[string]interface{}); ok {
-		if idx, ok := es["index"].(string); ok && idx != "" {
-			indexPath = "/" + idx
-		}
+	query, err := service.CompileLogQL("", filter, "level")
+	if err != nil {
+		return "{}"
 	}
-	urlStr := endpoint + indexPath + "/_search"
-	// ... body constr ...
-	// Simplified for brevity in this tool call, keeping original structure logic
-	timeField := "@timestamp"
-	if es, ok := cfg["es"].(map[string]interface{}); ok {
-		if tf, ok := es["timeField"].(string); ok && tf != "" {
-			timeField = tf
+	return query
+}
+
+// builderLabelFilter converts one builder label filter into a filter node.
+// Several values of =/!= are matched as an escaped regex alternation.
+func builderLabelFilter(label, op string, values []string) service.FilterNode {
+	switch op {
+	case "=~", "!~":
+		node := service.FilterNode{Op: service.FilterRegex, Field: label, Value: strings.Join(values, "|")}
+		if op == "!~" {
+			return service.FilterNode{Op: service.FilterNot, Children: []service.FilterNode{node}}
 		}
+		return node
 	}
-	nsToMs := func(s string, def int64) int64 {
-		if s == "" {
-			return def
-		}
-		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
-			return v / 1e6
+	node := service.FilterNode{Op: service.FilterEq, Field: label, Value: values[0]}
+	if len(values) > 1 {
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = regexp.QuoteMeta(v)
 		}
-		return def
-	}
-	nowMs := time.Now().UnixMilli()
-	startMs := nsToMs(c.Query("start"), nowMs-3600*1000)
-	endMs := nsToMs(c.Query("end"), nowMs)
-	q := c.Query("query")
-	if q == "" {
-		q = "*"
-	}
-	bodyJSON := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": func() []interface{} {
-					conds := make([]interface{}, 0, 2)
-					if q == "" || q == "*" {
-						conds = append(conds, map[string]interface{}{"match_all": map[string]interface{}{}})
-					} else {
-						conds = append(conds, map[string]interface{}{"query_string": map[string]interface{}{"query": q}})
-					}
-					conds = append(conds, map[string]interface{}{"range": map[string]interface{}{timeField: map[string]interface{}{"gte": startMs, "lte": endMs, "format": "epoch_millis"}}})
-					return conds
-				}(),
-			},
-		},
-	}
-	b, _ := json.MarshalIndent(bodyJSON, "", "  ")
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"url": urlStr, "body": string(b)}})
+		node = service.FilterNode{Op: service.FilterRegex, Field: label, Value: strings.Join(quoted, "|")}
+	}
+	if op == "!=" {
+		return service.FilterNode{Op: service.FilterNot, Children: []service.FilterNode{node}}
+	}
+	return node
 }
 
-func buildLokiQuery(filters []struct {
-	Label, Op string
-	Values    []string
-}, contains string) string {
-	if len(filters) == 0 && contains == "" {
-		return "{}"
+// queryFilter decodes the optional engine neutral filter param (JSON)
+func queryFilter(c *gin.Context) (*service.Filter, error) {
+	raw := c.Query("filter")
+	if raw == "" {
+		return nil, nil
 	}
-	var sb strings.Builder
-	sb.WriteString("{")
-	for i, f := range filters {
-		if i > 0 {
-			sb.WriteString(",")
-		}
-		sb.WriteString(f.Label)
-		sb.WriteString(f.Op)
-		sb.WriteString("\"")
-		sb.WriteString(strings.Join(f.Values, "|"))
-		sb.WriteString("\"")
-	}
-	sb.WriteString("}")
-	if contains != "" {
-		sb.WriteString(" |= \"")
-		sb.WriteString(contains)
-		sb.WriteString("\"")
-	}
-	return sb.String()
+	var f service.Filter
+	if err := json.Unmarshal([]byte(raw), &f); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return &f, nil
 }
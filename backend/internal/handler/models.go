@@ -1,23 +1,22 @@
 package handler
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"ailap-backend/internal/database"
 	"ailap-backend/internal/model"
+	"ailap-backend/internal/service"
 )
 
-type ModelsHandler struct{}
+type ModelsHandler struct {
+	aiService *service.AIService
+}
 
-func NewModelsHandler() *ModelsHandler { return &ModelsHandler{} }
+func NewModelsHandler() *ModelsHandler { return &ModelsHandler{aiService: service.NewAIService()} }
 
 func (h *ModelsHandler) List(c *gin.Context) {
 	var items []model.MLModel
@@ -50,6 +49,11 @@ func (h *ModelsHandler) Update(c *gin.Context) {
 		database.GetDB().Model(&model.MLModel{}).Where("is_default = ?", true).Update("is_default", false)
 	}
 	database.GetDB().Model(&model.MLModel{}).Where("id = ?", id).Updates(m)
+	// Updates(m) skips zero values; these settings use 0 for "default" / "off"
+	database.GetDB().Model(&model.MLModel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"context_tokens": m.ContextTokens, "fallback_order": m.FallbackOrder, "timeout_seconds": m.TimeoutSeconds, "max_retries": m.MaxRetries,
+		"prompt_price": m.PromptPrice, "completion_price": m.CompletionPrice,
+	})
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
 }
 
@@ -91,55 +95,26 @@ func (h *ModelsHandler) Test(c *gin.Context) {
 		return
 	}
 
-	if strings.TrimSpace(cfg.APIBase) == "" || strings.TrimSpace(cfg.APIKey) == "" || strings.TrimSpace(cfg.Model) == "" {
+	if err := service.ValidateModelConfig(&cfg); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请填写 API Base、API Key 和模型"})
 		return
 	}
 
-	endpoint := strings.TrimRight(cfg.APIBase, "/") + "/chat/completions"
-	payload := map[string]interface{}{
-		"model":       cfg.Model,
-		"messages":    []map[string]string{{"role": "user", "content": "ping"}},
-		"max_tokens":  1,
-		"temperature": 0,
-		"stream":      false,
-	}
-	body, _ := json.Marshal(payload)
-
-	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": err.Error()})
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"code": 502, "message": err.Error()})
+	err := h.aiService.TestModel(c.Request.Context(), &cfg)
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
 		return
 	}
-	defer resp.Body.Close()
-
-	respBytes, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		// Optionally ensure response looks like OpenAI-compatible format
-		var obj map[string]interface{}
-		if err := json.Unmarshal(respBytes, &obj); err == nil {
-			if _, ok := obj["choices"]; ok {
-				c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
-				return
-			}
-		}
-		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+	var perr *service.ProviderError
+	if !errors.As(err, &perr) {
+		c.JSON(http.StatusOK, gin.H{"code": 502, "message": err.Error()})
 		return
 	}
 
-	msg := string(respBytes)
+	msg := perr.Body
 	if len(msg) > 1024 {
 		msg = msg[:1024]
 	}
 	// Normalize provider errors to 200 to avoid FE interceptor logging the user out on 401/403
-	c.JSON(http.StatusOK, gin.H{"code": resp.StatusCode, "message": fmt.Sprintf("provider error: %s", msg)})
+	c.JSON(http.StatusOK, gin.H{"code": perr.StatusCode, "message": fmt.Sprintf("provider error: %s", msg)})
 }
@@ -23,7 +23,7 @@ func NewMonitorHandler(svc *service.MonitorService) *MonitorHandler {
 
 func (h *MonitorHandler) ListMonitors(c *gin.Context) {
 	var items []model.LogMonitor
-	if err := database.GetDB().Find(&items).Error; err != nil {
+	if err := database.GetDB().Preload("Routes").Find(&items).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
@@ -33,20 +33,45 @@ func (h *MonitorHandler) ListMonitors(c *gin.Context) {
 func (h *MonitorHandler) GetMonitor(c *gin.Context) {
 	id := c.Param("id")
 	var item model.LogMonitor
-	if err := database.GetDB().First(&item, id).Error; err != nil {
+	if err := database.GetDB().Preload("Routes").First(&item, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 1, "message": "not found"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"item": item}})
 }
 
+// validateMonitor checks a monitor before it is created or updated
+func validateMonitor(req *model.LogMonitor) error {
+	if _, err := service.ParseConditions(req.Conditions, req.Engine); err != nil {
+		return err
+	}
+	if err := service.ValidateLookback(req.Lookback); err != nil {
+		return err
+	}
+	if err := service.ValidateIngestDelay(req.IngestDelay); err != nil {
+		return err
+	}
+	if err := service.ValidateRenotifyInterval(req.RenotifyInterval); err != nil {
+		return err
+	}
+	return service.ValidateRoutes(req.Routes)
+}
+
 func (h *MonitorHandler) CreateMonitor(c *gin.Context) {
 	var req model.LogMonitor
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
-	if err := database.GetDB().Create(&req).Error; err != nil {
+	if err := validateMonitor(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := database.GetDB().Omit("Routes").Create(&req).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := service.SaveMonitorRoutes(req.ID, req.Routes); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
@@ -71,6 +96,10 @@ func (h *MonitorHandler) UpdateMonitor(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
+	if err := validateMonitor(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
 
 	item.Name = req.Name
 	item.DatasourceID = req.DatasourceID
@@ -78,10 +107,21 @@ func (h *MonitorHandler) UpdateMonitor(c *gin.Context) {
 	item.Cron = req.Cron
 	item.Query = req.Query
 	item.Keywords = req.Keywords
+	item.Filter = req.Filter
+	item.Conditions = req.Conditions
+	item.Lookback = req.Lookback
+	item.IngestDelay = req.IngestDelay
+	item.RenotifyInterval = req.RenotifyInterval
+	item.Role = req.Role
 	item.ChannelID = req.ChannelID
 	item.Status = req.Status
+	item.Routes = req.Routes
 
-	if err := database.GetDB().Save(&item).Error; err != nil {
+	if err := database.GetDB().Omit("Routes").Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	if err := service.SaveMonitorRoutes(item.ID, item.Routes); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
@@ -104,10 +144,26 @@ func (h *MonitorHandler) DeleteMonitor(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
+	database.GetDB().Where("monitor_id = ?", uid).Delete(&model.MonitorRun{})
+	database.GetDB().Where("monitor_id = ?", uid).Delete(&model.Alert{})
+	database.GetDB().Where("monitor_id = ?", uid).Delete(&model.Silence{})
+	database.GetDB().Where("monitor_id = ?", uid).Delete(&model.MonitorRoute{})
 
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
 }
 
+// ListRuns returns the execution history of a monitor, newest first
+func (h *MonitorHandler) ListRuns(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	items, err := h.svc.ListRuns(uint(id), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": gin.H{"items": items}})
+}
+
 // ---- Channels ----
 
 func (h *MonitorHandler) ListChannels(c *gin.Context) {
@@ -176,6 +232,7 @@ func (h *MonitorHandler) DeleteChannel(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1, "message": err.Error()})
 		return
 	}
+	database.GetDB().Where("channel_id = ?", id).Delete(&model.MonitorRoute{})
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
 }
 
@@ -0,0 +1,109 @@
+package model
+
+import "time"
+
+// AIConversation is a persisted multi-turn log analysis session. Logs holds
+// the JSON snapshot of the attached log rows so follow-up questions don't
+// need to resend them.
+type AIConversation struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	UserID    uint   `gorm:"index" json:"userId"`
+	Title     string `json:"title"`
+	ModelID   uint   `json:"modelId"`
+	ModelName string `json:"modelName"`
+	// Role and the prompt variables apply to every turn, see service.AnalysisRole
+	Role       string      `json:"role"`
+	Query      string      `gorm:"type:text" json:"query"`
+	Datasource string      `json:"datasource"`
+	TimeRange  string      `json:"timeRange"`
+	Logs       string      `gorm:"type:text" json:"-"`
+	LogCount   int         `json:"logCount"`
+	Messages   []AIMessage `gorm:"foreignKey:ConversationID;constraint:OnDelete:CASCADE" json:"messages,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+	// DatasourceID selects the custom redaction rules of the follow-ups
+	DatasourceID string `json:"datasourceId"`
+}
+
+// AIMessage is one turn of an AIConversation
+type AIMessage struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ConversationID uint      `gorm:"index" json:"conversationId"`
+	Role           string    `json:"role"` // user, assistant
+	Content        string    `gorm:"type:text" json:"content"`
+	ModelName      string    `json:"modelName,omitempty"` // model that answered, for assistant turns
+	CreatedAt      time.Time `json:"createdAt"`
+	// Citations is the JSON list of knowledge base excerpts the answer was given
+	Citations string `gorm:"type:text" json:"citations,omitempty"`
+}
+
+// AIAnalysis is a stored structured analysis (see service.StructuredAnalysis).
+// Result holds the validated JSON; Raw the last model reply, kept when it
+// could not be repaired (Valid false).
+type AIAnalysis struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"userId"`
+	MonitorID uint      `gorm:"index" json:"monitorId"` // set for monitor runs
+	Role      string    `json:"role"`
+	ModelID   uint      `json:"modelId"`
+	ModelName string    `json:"modelName"`
+	Severity  string    `gorm:"index" json:"severity"`
+	Valid     bool      `json:"valid"`
+	Result    string    `gorm:"type:text" json:"-"`
+	Raw       string    `gorm:"type:text" json:"raw,omitempty"`
+	LogCount  int       `json:"logCount"`
+	Citations string    `gorm:"type:text" json:"-"` // JSON list of service.Citation
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AIUsage records one model call for cost accounting. Token counts come from
+// the provider's usage block, or are estimated (Estimated) when it sends none.
+type AIUsage struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"index" json:"userId"`
+	MonitorID        uint      `gorm:"index" json:"monitorId"`
+	ModelID          uint      `gorm:"index" json:"modelId"`
+	ModelName        string    `json:"modelName"`
+	Provider         string    `json:"provider"`
+	Feature          string    `json:"feature"` // analyze, conversation, structured, monitor, generate-query, test
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	Estimated        bool      `json:"estimated"`
+	Cost             float64   `json:"cost"`
+	LatencyMs        int64     `json:"latencyMs"`
+	Status           string    `json:"status"` // ok, error, blocked
+	Error            string    `json:"error,omitempty"`
+	CreatedAt        time.Time `gorm:"index" json:"createdAt"`
+}
+
+// AIBudget caps the cost of model calls per day or month. Scope "global"
+// covers all calls, "model" and "user" the calls of ScopeID. Once exceeded,
+// "block" refuses calls and "degrade" only lets free models answer.
+type AIBudget struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `json:"name"`
+	Scope     string    `json:"scope"` // global, model, user
+	ScopeID   uint      `json:"scopeId"`
+	Period    string    `json:"period"`  // day, month
+	MaxCost   float64   `json:"maxCost"` // in the currency of the model prices
+	Action    string    `json:"action"`  // block, degrade
+	Enabled   bool      `gorm:"default:true" json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// AIRedaction audits the sensitive values replaced in the prompts of one
+// model call. Findings is a JSON object of kind -> distinct values; the values
+// themselves are never stored.
+type AIRedaction struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"index" json:"userId"`
+	MonitorID    uint      `gorm:"index" json:"monitorId"`
+	Feature      string    `json:"feature"`
+	DatasourceID string    `json:"datasourceId"`
+	ModelID      uint      `json:"modelId"`
+	ModelName    string    `json:"modelName"`
+	Findings     string    `gorm:"type:text" json:"findings"`
+	Total        int       `json:"total"`
+	CreatedAt    time.Time `gorm:"index" json:"createdAt"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+// Alert is one deduplicated alert of a monitor. Runs that match the same
+// fingerprint update the open alert instead of creating a new one.
+type Alert struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	MonitorID   uint   `gorm:"index" json:"monitorId"`
+	Fingerprint string `gorm:"index" json:"fingerprint"`
+	Labels      string `gorm:"type:text" json:"labels"` // JSON object, e.g. {"monitor":"api errors","service":"api"}
+	Severity    string `json:"severity"`
+	Status      string `gorm:"index" json:"status"` // firing, acknowledged, resolved
+	Summary     string `gorm:"type:text" json:"summary"`
+	// MissedRuns counts evaluated runs in a row that no longer matched
+	MissedRuns     int        `json:"missedRuns"`
+	StartsAt       time.Time  `json:"startsAt"`
+	LastSeenAt     time.Time  `json:"lastSeenAt"`
+	LastNotifiedAt *time.Time `json:"lastNotifiedAt"`
+	NotifyCount    int        `json:"notifyCount"`
+	SilenceID      uint       `json:"silenceId"` // silence that muted the last notification, 0 when none
+	AckedBy        uint       `json:"ackedBy"`
+	AckedAt        *time.Time `json:"ackedAt"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	RunID          uint       `json:"runId"` // last run that matched
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	// FirstNotifiedAt starts the escalation clock; EscalatedAt is the last escalation
+	FirstNotifiedAt *time.Time `json:"firstNotifiedAt"`
+	EscalatedAt     *time.Time `json:"escalatedAt"`
+	// Annotations is a JSON object describing the alert without identifying
+	// it, e.g. {"pattern":"user <*> failed"}; it is not part of the fingerprint
+	Annotations string `gorm:"type:text" json:"annotations"`
+}
+
+// Silence mutes the notifications of matching alerts between StartsAt and EndsAt
+type Silence struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	MonitorID uint      `gorm:"index" json:"monitorId"`    // 0 for every monitor
+	Matchers  string    `gorm:"type:text" json:"matchers"` // JSON label matchers, all must match
+	StartsAt  time.Time `json:"startsAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	Comment   string    `json:"comment"`
+	CreatedBy uint      `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
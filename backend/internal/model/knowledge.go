@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// KnowledgeDoc is a runbook, a markdown document or a resolved analysis in the
+// knowledge base used to ground AI analyses
+type KnowledgeDoc struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Title      string    `json:"title"`
+	Source     string    `gorm:"index" json:"source"`     // upload, analysis
+	AnalysisID uint      `gorm:"index" json:"analysisId"` // set for resolved analyses
+	Content    string    `gorm:"type:text" json:"content,omitempty"`
+	Chunks     int       `json:"chunks"`
+	CreatedBy  uint      `json:"createdBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// KnowledgeChunk is the retrieval unit of a KnowledgeDoc, usually one section
+type KnowledgeChunk struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	DocID   uint   `gorm:"index" json:"docId"`
+	Seq     int    `json:"seq"`
+	Heading string `json:"heading"`
+	Content string `gorm:"type:text" json:"content"`
+	Length  int    `json:"length"` // number of terms, for BM25 length normalisation
+}
+
+// KnowledgeTerm is a posting of the BM25 index: how often Term occurs in a chunk
+type KnowledgeTerm struct {
+	ID      uint   `gorm:"primaryKey"`
+	Term    string `gorm:"index"`
+	ChunkID uint   `gorm:"index"`
+	DocID   uint   `gorm:"index"`
+	Freq    int
+}
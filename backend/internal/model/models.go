@@ -4,19 +4,29 @@ import "time"
 
 // MLModel represents an AI model configuration
 // Provider examples: openai, deepseek, qwen
-// Roles is a JSON string storing an array of role definitions
+// Roles is a JSON string storing an array of role definitions (service.AnalysisRole)
 type MLModel struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	Name        string    `json:"name"`
-	Provider    string    `json:"provider"`
-	Model       string    `json:"model"`
-	APIBase     string    `json:"apiBase"`
-	APIKey      string    `json:"apiKey"`
-	Temperature float64   `json:"temperature"`
-	MaxTokens   int       `json:"maxTokens"`
-	Roles       string    `gorm:"type:text" json:"roles"`
-	Enabled     bool      `gorm:"default:true" json:"enabled"`
-	IsDefault   bool      `gorm:"default:false" json:"isDefault"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	Name        string  `json:"name"`
+	Provider    string  `json:"provider"`
+	Model       string  `json:"model"`
+	APIBase     string  `json:"apiBase"`
+	APIKey      string  `json:"apiKey"`
+	Temperature float64 `json:"temperature"`
+	MaxTokens   int     `json:"maxTokens"`
+	// ContextTokens is the model context window used to budget log context; 0 picks a default
+	ContextTokens int    `json:"contextTokens"`
+	Roles         string `gorm:"type:text" json:"roles"`
+	Enabled       bool   `gorm:"default:true" json:"enabled"`
+	IsDefault     bool   `gorm:"default:false" json:"isDefault"`
+	// FallbackOrder places the model in the fallback chain after the default
+	// model (ascending); 0 keeps it out of the chain
+	FallbackOrder  int `json:"fallbackOrder"`
+	TimeoutSeconds int `json:"timeoutSeconds"` // one call, or time to first byte when streaming; 0 = default
+	MaxRetries     int `json:"maxRetries"`     // retries on 429 / 5xx; 0 = default, negative disables
+	// Prices per million tokens used to cost AIUsage records; 0 means free
+	PromptPrice     float64   `json:"promptPrice"`
+	CompletionPrice float64   `json:"completionPrice"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
 }
@@ -25,8 +25,56 @@ type LogMonitor struct {
 	Cron         string     `json:"cron"`         // e.g., "@every 1h" or "0 * * * *"
 	Query        string     `json:"query"`        // base query
 	Keywords     string     `json:"keywords"`     // comma separated keywords to filter content
+	Filter       string     `json:"filter"`       // optional engine neutral filter (JSON), ANDed with Query
+	Conditions   string     `json:"conditions"`   // alert rule conditions (JSON); empty fires on any match
+	Role         string     `json:"role"`         // analysis role (persona), empty for the built-in one
 	ChannelID    uint       `json:"channelId"`
 	Status       string     `json:"status"` // active, paused
 	LastRunAt    *time.Time `json:"lastRunAt"`
 	ProjectID    uint       `json:"projectId"` // optional, for multi-tenancy if needed
+	// Lookback is an explicit window such as "15m". When empty each run covers
+	// the time since LastRunAt (the end of the last evaluated window)
+	Lookback string `json:"lookback"`
+	// IngestDelay such as "1m" ends each window that long before the run, so
+	// logs reaching the datasource late are still evaluated; empty uses the default
+	IngestDelay string `json:"ingestDelay"`
+	// RenotifyInterval is how often a still firing alert is sent again, e.g.
+	// "4h"; empty uses the default
+	RenotifyInterval string `json:"renotifyInterval"`
+	// Routes send alerts to channels by severity; when empty ChannelID is used
+	Routes []MonitorRoute `gorm:"foreignKey:MonitorID" json:"routes"`
+}
+
+// MonitorRoute links a monitor to a notification channel. Severities limits
+// the route to alerts of those severities; EscalateAfter makes it an
+// escalation route that is only notified when an alert is still not
+// acknowledged that many minutes after it was first sent.
+type MonitorRoute struct {
+	ID            uint   `gorm:"primarykey" json:"id"`
+	MonitorID     uint   `gorm:"index" json:"monitorId"`
+	ChannelID     uint   `gorm:"index" json:"channelId"`
+	Severities    string `json:"severities"`    // comma separated, empty for every severity
+	EscalateAfter int    `json:"escalateAfter"` // minutes, 0 notifies right away
+}
+
+// MonitorRun records one execution of a monitor, whether or not it alerted
+type MonitorRun struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	MonitorID  uint       `gorm:"index" json:"monitorId"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	Status     string     `json:"status"` // running, no_match, alerted, failed
+	// RangeStart / RangeEnd are the time window that was queried
+	RangeStart  time.Time `json:"rangeStart"`
+	RangeEnd    time.Time `json:"rangeEnd"`
+	Query       string    `gorm:"type:text" json:"query"` // effective query sent to the engine
+	Matches     int       `json:"matches"`                // rows returned, capped by the query limit
+	AnalysisID  uint      `json:"analysisId"`             // structured analysis record, 0 when none
+	Severity    string    `json:"severity"`
+	Analysis    string    `gorm:"type:text" json:"analysis"`
+	Notified    bool      `json:"notified"`
+	NotifyError string    `json:"notifyError"`
+	Error       string    `json:"error"`
+	// Conditions holds the evaluated rule conditions (JSON), empty without rules
+	Conditions string `gorm:"type:text" json:"conditions"`
 }
@@ -41,6 +41,10 @@ func New() *gin.Engine {
 
 		logs := api.Group("/logs")
 		logs.GET("/query", logsHandler.Query)
+		logs.GET("/tail", logsHandler.Tail)
+		logs.GET("/volume", logsHandler.Volume)
+		logs.GET("/patterns", logsHandler.Patterns)
+		logs.POST("/federated", logsHandler.FederatedQuery)
 		logs.GET("/suggestions", logsHandler.Suggestions)
 		logs.GET("/label-values", logsHandler.LabelValues)
 		logs.GET("/history", logsHandler.History)
@@ -66,6 +70,31 @@ func New() *gin.Engine {
 		ds.POST(":id/test", dsHandler.Test) // optional test by id (requires auth)
 		ai := api.Group("/ai")
 		ai.POST("/analyze-logs", aiHandler.AnalyzeLogs)
+		ai.POST("/analyze-logs/stream", aiHandler.AnalyzeLogsStream)
+		ai.POST("/generate-query", aiHandler.GenerateQuery)
+		ai.POST("/analyze-logs/structured", aiHandler.AnalyzeLogsStructured)
+		ai.GET("/analyses", aiHandler.ListAnalyses)
+		ai.GET("/analyses/:id", aiHandler.GetAnalysis)
+		ai.POST("/analyses/:id/resolve", aiHandler.ResolveAnalysis)
+		ai.GET("/knowledge", aiHandler.ListKnowledge)
+		ai.GET("/knowledge/search", aiHandler.SearchKnowledge)
+		ai.GET("/knowledge/:id", aiHandler.GetKnowledge)
+		ai.POST("/knowledge", aiHandler.CreateKnowledge)
+		ai.PUT("/knowledge/:id", aiHandler.UpdateKnowledge)
+		ai.DELETE("/knowledge/:id", aiHandler.DeleteKnowledge)
+		ai.GET("/roles", aiHandler.ListRoles)
+		ai.GET("/usage", aiHandler.ListUsage)
+		ai.GET("/usage/summary", aiHandler.UsageSummary)
+		ai.GET("/redactions", aiHandler.ListRedactions)
+		ai.POST("/redact/preview", aiHandler.PreviewRedaction)
+		ai.GET("/budgets", aiHandler.ListBudgets)
+		ai.POST("/budgets", aiHandler.CreateBudget)
+		ai.PUT("/budgets/:id", aiHandler.UpdateBudget)
+		ai.DELETE("/budgets/:id", aiHandler.DeleteBudget)
+		ai.GET("/conversations", aiHandler.ListConversations)
+		ai.GET("/conversations/:id", aiHandler.GetConversation)
+		ai.PUT("/conversations/:id", aiHandler.RenameConversation)
+		ai.DELETE("/conversations/:id", aiHandler.DeleteConversation)
 
 		monitorSvc := service.NewMonitorService()
 		monitorHandler := handler.NewMonitorHandler(monitorSvc)
@@ -76,6 +105,16 @@ func New() *gin.Engine {
 		monGroup.GET(":id", monitorHandler.GetMonitor)
 		monGroup.PUT(":id", monitorHandler.UpdateMonitor)
 		monGroup.DELETE(":id", monitorHandler.DeleteMonitor)
+		monGroup.GET(":id/runs", monitorHandler.ListRuns)
+
+		alertGroup := api.Group("/alerts")
+		alertGroup.GET("", monitorHandler.ListAlerts)
+		alertGroup.POST(":id/ack", monitorHandler.AckAlert)
+
+		silenceGroup := api.Group("/silences")
+		silenceGroup.GET("", monitorHandler.ListSilences)
+		silenceGroup.POST("", monitorHandler.CreateSilence)
+		silenceGroup.DELETE(":id", monitorHandler.ExpireSilence)
 
 		chanGroup := api.Group("/channels")
 		chanGroup.GET("", monitorHandler.ListChannels)
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+)
+
+// defaultContextTokens is assumed when a model has no ContextTokens set
+const defaultContextTokens = 8192
+
+// contextReserveTokens is kept free for the system prompt, the question and prior turns
+const contextReserveTokens = 1024
+
+// maxContextLine caps a single message in the packed context
+const maxContextLine = 600
+
+// levelPriority orders groups in the packed context, most severe first
+var levelPriority = map[string]int{LevelFatal: 0, LevelError: 1, LevelWarn: 2, LevelUnknown: 3, LevelInfo: 4, LevelDebug: 5, LevelTrace: 6}
+
+// serviceLabels are checked in order to name the service of a row
+var serviceLabels = []string{"service", "service_name", "app", "application", "job", "container", "k8s.container.name", "container_name"}
+
+// PackedContext is the log context sent to a model together with what had to be left out
+type PackedContext struct {
+	Text          string         `json:"-"`
+	TotalRows     int            `json:"totalRows"`
+	UniqueLines   int            `json:"uniqueLines"`
+	IncludedLines int            `json:"includedLines"`
+	OmittedLines  int            `json:"omittedLines"`
+	OmittedRows   int            `json:"omittedRows"`
+	OmittedLevels map[string]int `json:"omittedLevels,omitempty"` // omitted rows per level
+}
+
+// packedLine is one message pattern of a group with its repeat count
+type packedLine struct {
+	pattern     *LogPattern
+	sample      string // first raw message of the pattern in this group
+	row         int    // index of that message in the analysed logs, cited as evidence
+	message     string // rendered once mining is complete
+	count       int
+	first, last string
+}
+
+// packedGroup collects the distinct messages of one level / service pair
+type packedGroup struct {
+	level, service string
+	rows           int
+	lines          []*packedLine
+	index          map[*LogPattern]*packedLine
+}
+
+// contextBudget returns how many tokens of log context fit the model
+func contextBudget(cfg *model.MLModel) int {
+	window := cfg.ContextTokens
+	if window <= 0 {
+		window = defaultContextTokens
+	}
+	budget := window - chooseInt(cfg.MaxTokens, 512) - contextReserveTokens
+	if budget < 256 {
+		budget = 256
+	}
+	return budget
+}
+
+// estimateTokens approximates the token count of s: about four characters per
+// token for latin text and one token per CJK character
+func estimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			other += 2
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + (other+1)/2
+}
+
+// datasourceMapping returns the normalization rules of a datasource, none
+// when id is empty or unknown
+func datasourceMapping(id string) FieldMapping {
+	if id == "" {
+		return FieldMapping{}
+	}
+	var ds model.DataSource
+	if err := database.GetDB().First(&ds, "id = ?", id).Error; err != nil {
+		return FieldMapping{}
+	}
+	var cfg map[string]interface{}
+	_ = json.Unmarshal([]byte(ds.Config), &cfg)
+	return FieldMappingFromConfig(cfg)
+}
+
+// PackLogContext builds the log context for a model within a token budget.
+// Rows are normalized with the datasource's mapping (dropping __raw), messages
+// are clustered into patterns (see PatternMiner) and merged with a count, and
+// groups are emitted per level and service with errors first. Lines that
+// don't fit are summarised at the end.
+func (s *AIService) PackLogContext(logs []interface{}, budget int, mapping FieldMapping) *PackedContext {
+	groups := map[string]*packedGroup{}
+	miner := NewPatternMiner()
+	for i, row := range logs {
+		m, ok := row.(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{"message": fmt.Sprintf("%v", row)}
+		}
+		m = s.logService.NormalizeEntry(m, mapping)
+		level, _ := m["level"].(string)
+		labels, _ := m["labels"].(map[string]interface{})
+		svc := ""
+		for _, key := range serviceLabels {
+			if svc = stringValue(labels[key]); svc != "" {
+				break
+			}
+		}
+		key := level + "\x00" + svc
+		g, ok := groups[key]
+		if !ok {
+			g = &packedGroup{level: level, service: svc, index: map[*LogPattern]*packedLine{}}
+			groups[key] = g
+		}
+		g.rows++
+		pattern := miner.Add(m)
+		ts, _ := m["timestamp"].(string)
+		line, ok := g.index[pattern]
+		if !ok {
+			line = &packedLine{pattern: pattern, sample: strings.TrimSpace(stringValue(m["message"])), row: i, first: ts, last: ts}
+			g.index[pattern] = line
+			g.lines = append(g.lines, line)
+		}
+		line.count++
+		if ts != "" && (line.first == "" || ts < line.first) {
+			line.first = ts
+		}
+		if ts > line.last {
+			line.last = ts
+		}
+	}
+
+	// Fills in the final template text of every pattern
+	miner.Patterns()
+
+	ordered := make([]*packedGroup, 0, len(groups))
+	for _, g := range groups {
+		for _, l := range g.lines {
+			l.message = packedMessage(l)
+		}
+		sort.SliceStable(g.lines, func(i, j int) bool { return g.lines[i].count > g.lines[j].count })
+		ordered = append(ordered, g)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		pi, pj := levelPriority[ordered[i].level], levelPriority[ordered[j].level]
+		if pi != pj {
+			return pi < pj
+		}
+		return ordered[i].rows > ordered[j].rows
+	})
+
+	out := &PackedContext{TotalRows: len(logs), OmittedLevels: map[string]int{}}
+	// Every group first gets its most frequent line so each level / service
+	// is represented, then the budget is filled in priority order (errors first)
+	next := make([]int, len(ordered))
+	used := 0
+	take := func(gi int) bool {
+		g := ordered[gi]
+		cost := estimateTokens(formatPackedLine(g.lines[next[gi]]))
+		if next[gi] == 0 {
+			cost += estimateTokens(groupHeader(g))
+		}
+		if used+cost > budget {
+			return false
+		}
+		used += cost
+		next[gi]++
+		return true
+	}
+	for gi := range ordered {
+		if !take(gi) {
+			break
+		}
+	}
+fill:
+	for gi, g := range ordered {
+		for next[gi] > 0 && next[gi] < len(g.lines) {
+			if !take(gi) {
+				break fill
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d rows, %d distinct lines; line format: #row xN(repeats) first~last message\n", out.TotalRows, countLines(ordered))
+	for gi, g := range ordered {
+		out.UniqueLines += len(g.lines)
+		if next[gi] > 0 {
+			sb.WriteString(groupHeader(g))
+			for _, l := range g.lines[:next[gi]] {
+				sb.WriteString(formatPackedLine(l))
+				sb.WriteByte('\n')
+			}
+		}
+		out.IncludedLines += next[gi]
+		for _, l := range g.lines[next[gi]:] {
+			out.OmittedLines++
+			out.OmittedRows += l.count
+			out.OmittedLevels[g.level] += l.count
+		}
+	}
+	if out.OmittedLines > 0 {
+		levels := make([]string, 0, len(out.OmittedLevels))
+		for level, n := range out.OmittedLevels {
+			levels = append(levels, fmt.Sprintf("%s=%d", level, n))
+		}
+		sort.Strings(levels)
+		fmt.Fprintf(&sb, "... omitted %d distinct lines (%d rows): %s\n", out.OmittedLines, out.OmittedRows, strings.Join(levels, ", "))
+	}
+	out.Text = sb.String()
+	return out
+}
+
+func countLines(groups []*packedGroup) int {
+	n := 0
+	for _, g := range groups {
+		n += len(g.lines)
+	}
+	return n
+}
+
+// groupHeader introduces the lines of one level / service group
+func groupHeader(g *packedGroup) string {
+	svc := g.service
+	if svc == "" {
+		svc = "-"
+	}
+	return fmt.Sprintf("## level=%s service=%s rows=%d\n", g.level, svc, g.rows)
+}
+
+// packedMessage shows single rows verbatim and repeated ones as their
+// template followed by one example
+func packedMessage(l *packedLine) string {
+	msg := l.sample
+	if l.count > 1 && l.pattern.Pattern != l.sample {
+		msg = l.pattern.Pattern + " | e.g. " + l.sample
+	}
+	if r := []rune(msg); len(r) > maxContextLine {
+		msg = string(r[:maxContextLine]) + "…"
+	}
+	return msg
+}
+
+// formatPackedLine renders a deduplicated message with its row number, count
+// and time span
+func formatPackedLine(l *packedLine) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#%d ", l.row)
+	if l.count > 1 {
+		fmt.Fprintf(&sb, "x%d ", l.count)
+	}
+	if l.first != "" {
+		sb.WriteString(l.first)
+		if l.last != l.first {
+			sb.WriteString("~" + l.last)
+		}
+		sb.WriteByte(' ')
+	}
+	sb.WriteString(l.message)
+	return sb.String()
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+)
+
+// maxConversationTurns caps how many prior messages are replayed to the model
+const maxConversationTurns = 20
+
+// ConverseRequest is one user turn of a conversation. A zero ConversationID
+// starts a new conversation; Logs, Role and the prompt variables replace the
+// stored ones when non-empty.
+type ConverseRequest struct {
+	UserID         uint
+	ConversationID uint
+	AnalysisInput
+}
+
+// ConverseReply is the answer of one turn with the knowledge base excerpts
+// the model was given
+type ConverseReply struct {
+	Content   string
+	Citations []Citation
+}
+
+// Converse sends the log snapshot, the prior turns and the prompt to the model
+// chain and then stores the prompt and the reply, with the model that gave it,
+// together. A failed model call stores neither, so a retry does not leave an
+// unanswered prompt behind. When onDelta is set the reply is streamed through
+// it. The conversation is returned even when the model call fails so callers
+// can report its id.
+func (s *AIService) Converse(ctx context.Context, req ConverseRequest, onDelta func(delta string) error) (*model.AIConversation, *ConverseReply, error) {
+	if _, err := modelChain(); err != nil {
+		return nil, nil, err
+	}
+	role, err := resolveRole(req.Role)
+	if err != nil {
+		return nil, nil, err
+	}
+	prompt := strings.TrimSpace(req.Prompt)
+	if prompt == "" {
+		prompt = role.defaultPrompt()
+	}
+
+	conv, err := s.openConversation(req, prompt)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Follow-ups keep the role the conversation started with
+	if req.Role == "" && conv.Role != "" {
+		if role, err = resolveRole(conv.Role); err != nil {
+			return conv, nil, err
+		}
+	}
+	var history []model.AIMessage
+	if err := database.GetDB().Where("conversation_id = ?", conv.ID).Order("id desc").Limit(maxConversationTurns).Find(&history).Error; err != nil {
+		return conv, nil, err
+	}
+
+	in := AnalysisInput{Query: conv.Query, Datasource: conv.Datasource, DatasourceID: conv.DatasourceID, TimeRange: conv.TimeRange}
+	_ = json.Unmarshal([]byte(conv.Logs), &in.Logs)
+	in = s.withKnowledge(in, prompt)
+	// The log context is packed per model since context windows differ
+	build := func(cfg *model.MLModel) ChatRequest {
+		messages := []map[string]string{{"role": "system", "content": s.systemPrompt(cfg, role, in)}}
+		for i := len(history) - 1; i >= 0; i-- {
+			messages = append(messages, map[string]string{"role": history[i].Role, "content": history[i].Content})
+		}
+		messages = append(messages, map[string]string{"role": "user", "content": prompt})
+		return chatRequest(cfg, messages, chooseFloat(cfg.Temperature, 0.3))
+	}
+
+	var reply string
+	var cfg *model.MLModel
+	ctx = WithUsageScope(ctx, UsageScope{UserID: req.UserID, Feature: FeatureConversation})
+	ctx = WithRedactionSource(ctx, conv.DatasourceID)
+	if onDelta != nil {
+		reply, cfg, err = s.chatStream(ctx, build, onDelta)
+	} else {
+		reply, cfg, err = s.chat(ctx, build)
+	}
+	if err != nil {
+		return conv, nil, err
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		messages := []model.AIMessage{
+			{ConversationID: conv.ID, Role: "user", Content: prompt},
+			{ConversationID: conv.ID, Role: "assistant", Content: reply, ModelName: cfg.Name, Citations: marshalCitations(in.knowledge)},
+		}
+		if err := tx.Create(&messages).Error; err != nil {
+			return err
+		}
+		return tx.Model(conv).Updates(map[string]interface{}{"model_id": cfg.ID, "model_name": cfg.Name}).Error
+	})
+	if err != nil {
+		return conv, nil, err
+	}
+	conv.ModelID, conv.ModelName = cfg.ID, cfg.Name
+	return conv, &ConverseReply{Content: reply, Citations: in.knowledge}, nil
+}
+
+// openConversation loads the user's conversation or creates a new one titled
+// after the first prompt, replacing the log snapshot and prompt variables
+// when given
+func (s *AIService) openConversation(req ConverseRequest, prompt string) (*model.AIConversation, error) {
+	var conv model.AIConversation
+	if req.ConversationID != 0 {
+		if err := database.GetDB().Where("id = ? AND user_id = ?", req.ConversationID, req.UserID).First(&conv).Error; err != nil {
+			return nil, fmt.Errorf("conversation not found")
+		}
+	} else {
+		conv = model.AIConversation{UserID: req.UserID, Title: conversationTitle(prompt)}
+	}
+	for _, f := range []struct {
+		dst *string
+		v   string
+	}{
+		{&conv.Role, req.Role}, {&conv.Query, req.Query}, {&conv.Datasource, req.Datasource}, {&conv.DatasourceID, req.DatasourceID}, {&conv.TimeRange, req.TimeRange},
+	} {
+		if v := strings.TrimSpace(f.v); v != "" {
+			*f.dst = v
+		}
+	}
+	if len(req.Logs) > 0 {
+		b, _ := json.Marshal(req.Logs)
+		conv.Logs = string(b)
+		conv.LogCount = len(req.Logs)
+	}
+	if err := database.GetDB().Save(&conv).Error; err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// conversationTitle uses the first 40 characters of the opening prompt
+func conversationTitle(prompt string) string {
+	runes := []rune(strings.TrimSpace(prompt))
+	if len(runes) > 40 {
+		return string(runes[:40]) + "..."
+	}
+	return string(runes)
+}
+
+// ListConversations returns the user's conversations, most recent first
+func (s *AIService) ListConversations(userID uint) ([]model.AIConversation, error) {
+	var items []model.AIConversation
+	err := database.GetDB().Where("user_id = ?", userID).Order("updated_at desc").Find(&items).Error
+	return items, err
+}
+
+// GetConversation loads a conversation with its messages and log snapshot
+func (s *AIService) GetConversation(userID, id uint) (*model.AIConversation, []interface{}, error) {
+	var conv model.AIConversation
+	err := database.GetDB().Preload("Messages", func(db *gorm.DB) *gorm.DB { return db.Order("id asc") }).
+		Where("id = ? AND user_id = ?", id, userID).First(&conv).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	logs := make([]interface{}, 0)
+	_ = json.Unmarshal([]byte(conv.Logs), &logs)
+	return &conv, logs, nil
+}
+
+// RenameConversation changes the title of the user's conversation
+func (s *AIService) RenameConversation(userID, id uint, title string) error {
+	res := database.GetDB().Model(&model.AIConversation{}).Where("id = ? AND user_id = ?", id, userID).Update("title", strings.TrimSpace(title))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("conversation not found")
+	}
+	return nil
+}
+
+// DeleteConversation removes the user's conversation and its messages
+func (s *AIService) DeleteConversation(userID, id uint) error {
+	res := database.GetDB().Where("id = ? AND user_id = ?", id, userID).Delete(&model.AIConversation{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("conversation not found")
+	}
+	return database.GetDB().Where("conversation_id = ?", id).Delete(&model.AIMessage{}).Error
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+	"ailap-backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// Defaults of the per-model call policy, see MLModel.TimeoutSeconds and MaxRetries
+const (
+	defaultModelTimeout = 60 * time.Second
+	defaultModelRetries = 2
+	retryBaseDelay      = 500 * time.Millisecond
+	retryMaxDelay       = 10 * time.Second
+)
+
+// Circuit breaker: after breakerThreshold consecutive failures a provider
+// endpoint is skipped for breakerCooldown, then tried again
+const (
+	breakerThreshold = 3
+	breakerCooldown  = time.Minute
+)
+
+// modelChain returns the enabled default model followed by the enabled
+// fallback models in FallbackOrder. Models with an incomplete config are skipped.
+func modelChain() ([]*model.MLModel, error) {
+	var items []model.MLModel
+	err := database.GetDB().Where("enabled = ? AND (is_default = ? OR fallback_order > 0)", true, true).
+		Order("is_default desc, fallback_order asc, id asc").Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	chain := make([]*model.MLModel, 0, len(items))
+	var invalid error
+	for i := range items {
+		if err := ValidateModelConfig(&items[i]); err != nil {
+			utils.GetLogger().Warn("ai model skipped", zap.Uint("model_id", items[i].ID), zap.Error(err))
+			if invalid == nil {
+				invalid = err
+			}
+			continue
+		}
+		chain = append(chain, &items[i])
+	}
+	if len(chain) == 0 {
+		if invalid != nil {
+			return nil, invalid
+		}
+		return nil, fmt.Errorf("no enabled default model found")
+	}
+	return chain, nil
+}
+
+// modelTimeout bounds one call to cfg
+func modelTimeout(cfg *model.MLModel) time.Duration {
+	if cfg.TimeoutSeconds > 0 {
+		return time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return defaultModelTimeout
+}
+
+// circuitBreaker tracks consecutive failures per provider endpoint
+type circuitBreaker struct {
+	mu     sync.Mutex
+	states map[string]*circuitState
+}
+
+type circuitState struct {
+	failures  int
+	openUntil time.Time
+}
+
+var breaker = &circuitBreaker{states: map[string]*circuitState{}}
+
+// breakerKey groups models served by the same endpoint, so one outage opens
+// the circuit for all of them
+func breakerKey(cfg *model.MLModel) string {
+	return cfg.Provider + "|" + cfg.APIBase
+}
+
+// allow reports whether the circuit is closed or its cooldown has passed
+func (b *circuitBreaker) allow(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.states[key]
+	return !ok || time.Now().After(st.openUntil)
+}
+
+func (b *circuitBreaker) success(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.states, key)
+}
+
+// failure counts a failed call and opens the circuit at the threshold. A
+// failed trial after the cooldown reopens it right away.
+func (b *circuitBreaker) failure(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.states[key]
+	if !ok {
+		st = &circuitState{}
+		b.states[key] = st
+	}
+	st.failures++
+	if st.failures >= breakerThreshold {
+		st.openUntil = time.Now().Add(breakerCooldown)
+		utils.GetLogger().Warn("ai provider circuit open", zap.String("endpoint", key), zap.Int("failures", st.failures))
+	}
+}
+
+// haltError stops the fallback chain, e.g. once part of a streamed reply was sent
+type haltError struct{ err error }
+
+func (e *haltError) Error() string { return e.err.Error() }
+func (e *haltError) Unwrap() error { return e.err }
+
+// callModels runs call against the models of the chain until one answers and
+// returns the reply with the model that gave it. Models whose circuit is open
+// are skipped unless every circuit is open, models over budget always (see
+// checkBudget).
+func (s *AIService) callModels(ctx context.Context, call func(ctx context.Context, cfg *model.MLModel) (string, error)) (string, *model.MLModel, error) {
+	chain, err := modelChain()
+	if err != nil {
+		return "", nil, err
+	}
+	candidates := make([]*model.MLModel, 0, len(chain))
+	for _, cfg := range chain {
+		if breaker.allow(breakerKey(cfg)) {
+			candidates = append(candidates, cfg)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = chain
+	}
+
+	var lastErr error
+	for i, cfg := range candidates {
+		if err := checkBudget(ctx, cfg); err != nil {
+			recordBlocked(ctx, cfg, err)
+			utils.GetLogger().Warn("ai call blocked by budget", zap.Uint("model_id", cfg.ID), zap.Error(err))
+			var be *BudgetError
+			if errors.As(err, &be) && be.Stop {
+				return "", nil, err
+			}
+			lastErr = err
+			continue
+		}
+		reply, err := callWithRetry(ctx, cfg, call)
+		if err == nil {
+			breaker.success(breakerKey(cfg))
+			if cfg != chain[0] {
+				utils.GetLogger().Info("ai fallback model answered", zap.Uint("model_id", cfg.ID), zap.String("model", cfg.Name))
+			}
+			return reply, cfg, nil
+		}
+		var halt *haltError
+		if errors.As(err, &halt) {
+			return reply, cfg, halt.err
+		}
+		if ctx.Err() != nil {
+			return "", cfg, err
+		}
+		if providerDown(err) {
+			breaker.failure(breakerKey(cfg))
+		}
+		utils.GetLogger().Warn("ai model failed", zap.Uint("model_id", cfg.ID), zap.String("model", cfg.Name),
+			zap.Bool("has_fallback", i < len(candidates)-1), zap.Error(err))
+		lastErr = err
+	}
+	return "", nil, lastErr
+}
+
+// callWithRetry retries call on rate limits, server errors and connection
+// failures with exponential backoff, honouring Retry-After
+func callWithRetry(ctx context.Context, cfg *model.MLModel, call func(ctx context.Context, cfg *model.MLModel) (string, error)) (string, error) {
+	retries := cfg.MaxRetries
+	if retries == 0 {
+		retries = defaultModelRetries
+	}
+	for attempt := 0; ; attempt++ {
+		reply, err := call(ctx, cfg)
+		if err == nil || attempt >= retries || !retryable(err) || ctx.Err() != nil {
+			return reply, err
+		}
+		delay := retryBaseDelay << attempt
+		var pe *ProviderError
+		if errors.As(err, &pe) && pe.RetryAfter > 0 {
+			delay = pe.RetryAfter
+		}
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryable reports whether a failed call may succeed when repeated. Timeouts
+// are not retried, the next model of the chain is tried instead.
+func retryable(err error) bool {
+	var halt *haltError
+	if errors.As(err, &halt) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe.StatusCode == http.StatusTooManyRequests || pe.StatusCode >= 500
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return !ne.Timeout()
+	}
+	return false
+}
+
+// providerDown reports whether an error counts against the provider in the
+// circuit breaker: the retryable errors plus timeouts. Request errors such as
+// a 400 for an oversized prompt or a 401 say nothing about its health.
+func providerDown(err error) bool {
+	if retryable(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,492 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+	"ailap-backend/internal/utils"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Sources of a KnowledgeDoc
+const (
+	KnowledgeUpload   = "upload"
+	KnowledgeAnalysis = "analysis"
+)
+
+// BM25 parameters and retrieval limits
+const (
+	bm25K1                = 1.2
+	bm25B                 = 0.75
+	knowledgeTopK         = 4
+	knowledgeChunksPerDoc = 2
+	// knowledgeMinRelative drops hits scoring below this share of the best one
+	knowledgeMinRelative = 0.3
+	maxKnowledgeTerms    = 64
+	maxKnowledgeLogRows  = 50
+	maxChunkChars        = 1200
+	maxSnippetChars      = 800
+	maxCitationSnippet   = 200
+)
+
+// knowledgeStopwords are frequent English words that carry no meaning for retrieval
+var knowledgeStopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true, "from": true, "are": true,
+	"was": true, "were": true, "has": true, "have": true, "not": true, "but": true, "you": true, "your": true,
+	"can": true, "will": true, "into": true, "when": true, "then": true, "than": true, "what": true, "which": true,
+	"how": true, "why": true, "all": true, "any": true, "its": true, "our": true, "use": true, "should": true,
+	"there": true, "their": true, "they": true, "been": true, "also": true, "may": true, "more": true, "such": true,
+}
+
+// knowledgeTerms tokenises text for the BM25 index: lower-cased latin words
+// and numbers-with-letters, plus bigrams of Han runs since Chinese has no spaces.
+// Pure numbers and long hex ids are dropped as they never repeat across incidents.
+func knowledgeTerms(text string) []string {
+	var terms []string
+	var word []rune
+	var han []rune
+	flushWord := func() {
+		w := string(word)
+		word = word[:0]
+		if len(w) < 2 || len(w) > 40 || knowledgeStopwords[w] || isNumberOrHex(w) {
+			return
+		}
+		terms = append(terms, w)
+	}
+	flushHan := func() {
+		if len(han) == 1 {
+			terms = append(terms, string(han))
+		}
+		for i := 0; i+1 < len(han); i++ {
+			terms = append(terms, string(han[i:i+2]))
+		}
+		han = han[:0]
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			flushHan()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return terms
+}
+
+func isNumberOrHex(w string) bool {
+	digits, hex := true, len(w) >= 16
+	for _, r := range w {
+		if r < '0' || r > '9' {
+			digits = false
+		}
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			hex = false
+		}
+	}
+	return digits || hex
+}
+
+type knowledgeSection struct {
+	heading string
+	content string
+}
+
+// chunkMarkdown splits a document into sections at its headings; sections
+// longer than maxChunkChars are split at paragraph breaks. The heading is the
+// path of the enclosing headings, e.g. "Payments › Timeouts".
+func chunkMarkdown(content string) []knowledgeSection {
+	type heading struct {
+		level int
+		title string
+	}
+	var sections []knowledgeSection
+	var headings []heading
+	var body []string
+	inFence := false
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		body = body[:0]
+		if text == "" {
+			return
+		}
+		path := make([]string, len(headings))
+		for i, h := range headings {
+			path[i] = h.title
+		}
+		for _, part := range splitLong(text) {
+			sections = append(sections, knowledgeSection{heading: strings.Join(path, " › "), content: part})
+		}
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if !inFence && strings.HasPrefix(trimmed, "#") {
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			title := strings.TrimSpace(trimmed[level:])
+			if level <= 6 && title != "" && (trimmed[level] == ' ' || trimmed[level] == '\t') {
+				flush()
+				for len(headings) > 0 && headings[len(headings)-1].level >= level {
+					headings = headings[:len(headings)-1]
+				}
+				headings = append(headings, heading{level: level, title: title})
+				continue
+			}
+		}
+		body = append(body, line)
+	}
+	flush()
+	return sections
+}
+
+// splitLong cuts text into pieces of about maxChunkChars at blank lines,
+// falling back to line breaks for long paragraphs
+func splitLong(text string) []string {
+	if len(text) <= maxChunkChars {
+		return []string{text}
+	}
+	var parts []string
+	var cur strings.Builder
+	add := func(piece, sep string) {
+		if cur.Len() > 0 && cur.Len()+len(piece) > maxChunkChars {
+			parts = append(parts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+		if cur.Len() > 0 {
+			cur.WriteString(sep)
+		}
+		cur.WriteString(piece)
+	}
+	for _, para := range strings.Split(text, "\n\n") {
+		if len(para) <= maxChunkChars {
+			add(para, "\n\n")
+			continue
+		}
+		for _, line := range strings.Split(para, "\n") {
+			add(line, "\n")
+		}
+	}
+	if strings.TrimSpace(cur.String()) != "" {
+		parts = append(parts, strings.TrimSpace(cur.String()))
+	}
+	return parts
+}
+
+// SaveKnowledgeDoc creates or replaces a document and rebuilds its index entries
+func (s *AIService) SaveKnowledgeDoc(doc *model.KnowledgeDoc) error {
+	doc.Title = strings.TrimSpace(doc.Title)
+	if doc.Title == "" || strings.TrimSpace(doc.Content) == "" {
+		return fmt.Errorf("title and content are required")
+	}
+	if doc.Source == "" {
+		doc.Source = KnowledgeUpload
+	}
+	sections := chunkMarkdown(doc.Content)
+	doc.Chunks = len(sections)
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(doc).Error; err != nil {
+			return err
+		}
+		if err := deleteKnowledgeIndex(tx, doc.ID); err != nil {
+			return err
+		}
+		for i, sec := range sections {
+			terms := knowledgeTerms(doc.Title + "\n" + sec.heading + "\n" + sec.content)
+			chunk := model.KnowledgeChunk{DocID: doc.ID, Seq: i, Heading: sec.heading, Content: sec.content, Length: len(terms)}
+			if err := tx.Create(&chunk).Error; err != nil {
+				return err
+			}
+			freq := map[string]int{}
+			for _, t := range terms {
+				freq[t]++
+			}
+			postings := make([]model.KnowledgeTerm, 0, len(freq))
+			for t, n := range freq {
+				postings = append(postings, model.KnowledgeTerm{Term: t, ChunkID: chunk.ID, DocID: doc.ID, Freq: n})
+			}
+			if len(postings) > 0 {
+				if err := tx.CreateInBatches(postings, 200).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func deleteKnowledgeIndex(tx *gorm.DB, docID uint) error {
+	if err := tx.Where("doc_id = ?", docID).Delete(&model.KnowledgeTerm{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("doc_id = ?", docID).Delete(&model.KnowledgeChunk{}).Error
+}
+
+// DeleteKnowledgeDoc removes a document with its index entries
+func (s *AIService) DeleteKnowledgeDoc(id uint) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := deleteKnowledgeIndex(tx, id); err != nil {
+			return err
+		}
+		return tx.Delete(&model.KnowledgeDoc{}, id).Error
+	})
+}
+
+// ListKnowledgeDocs lists the documents without their content, optionally of one source
+func (s *AIService) ListKnowledgeDocs(source string) ([]model.KnowledgeDoc, error) {
+	q := database.GetDB().Omit("content").Order("updated_at desc")
+	if source != "" {
+		q = q.Where("source = ?", source)
+	}
+	var items []model.KnowledgeDoc
+	err := q.Find(&items).Error
+	return items, err
+}
+
+// GetKnowledgeDoc returns a document with its content
+func (s *AIService) GetKnowledgeDoc(id uint) (*model.KnowledgeDoc, error) {
+	var doc model.KnowledgeDoc
+	if err := database.GetDB().First(&doc, id).Error; err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Citation is a knowledge base excerpt given to the model. Ref is how the
+// answer refers to it, e.g. "K1".
+type Citation struct {
+	Ref        string  `json:"ref"`
+	DocID      uint    `json:"docId"`
+	ChunkID    uint    `json:"chunkId"`
+	Title      string  `json:"title"`
+	Heading    string  `json:"heading,omitempty"`
+	Source     string  `json:"source"`
+	AnalysisID uint    `json:"analysisId,omitempty"`
+	Score      float64 `json:"score"`
+	Snippet    string  `json:"snippet"`
+	content    string
+}
+
+// SearchKnowledge ranks the chunks by BM25 against query and returns the best
+// ones, at most knowledgeChunksPerDoc per document
+func (s *AIService) SearchKnowledge(query string, limit int) ([]Citation, error) {
+	limit = chooseInt(limit, knowledgeTopK)
+	seen := map[string]bool{}
+	var terms []string
+	for _, t := range knowledgeTerms(query) {
+		if !seen[t] && len(terms) < maxKnowledgeTerms {
+			seen[t] = true
+			terms = append(terms, t)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	db := database.GetDB()
+	var stats struct {
+		N     int64
+		AvgDL float64
+	}
+	if err := db.Model(&model.KnowledgeChunk{}).Select("COUNT(*) AS n, AVG(length) AS avg_dl").Scan(&stats).Error; err != nil || stats.N == 0 {
+		return nil, err
+	}
+	var postings []model.KnowledgeTerm
+	if err := db.Where("term IN ?", terms).Find(&postings).Error; err != nil {
+		return nil, err
+	}
+	df := map[string]int{}
+	for _, p := range postings {
+		df[p.Term]++
+	}
+	chunkIDs := make([]uint, 0, len(postings))
+	for _, p := range postings {
+		chunkIDs = append(chunkIDs, p.ChunkID)
+	}
+	var chunks []model.KnowledgeChunk
+	if err := db.Where("id IN ?", chunkIDs).Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*model.KnowledgeChunk, len(chunks))
+	for i := range chunks {
+		byID[chunks[i].ID] = &chunks[i]
+	}
+
+	scores := map[uint]float64{}
+	for _, p := range postings {
+		c, ok := byID[p.ChunkID]
+		if !ok {
+			continue
+		}
+		idf := math.Log(1 + (float64(stats.N)-float64(df[p.Term])+0.5)/(float64(df[p.Term])+0.5))
+		tf := float64(p.Freq)
+		norm := 1 - bm25B + bm25B*float64(c.Length)/math.Max(stats.AvgDL, 1)
+		scores[p.ChunkID] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+	}
+	ranked := make([]uint, 0, len(scores))
+	for id := range scores {
+		ranked = append(ranked, id)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+
+	var out []Citation
+	perDoc := map[uint]int{}
+	docs := map[uint]*model.KnowledgeDoc{}
+	for _, id := range ranked {
+		if len(out) >= limit || scores[id] < knowledgeMinRelative*scores[ranked[0]] {
+			break
+		}
+		c := byID[id]
+		if perDoc[c.DocID] >= knowledgeChunksPerDoc {
+			continue
+		}
+		doc, ok := docs[c.DocID]
+		if !ok {
+			doc = &model.KnowledgeDoc{}
+			if db.Omit("content").First(doc, c.DocID).Error != nil {
+				continue
+			}
+			docs[c.DocID] = doc
+		}
+		perDoc[c.DocID]++
+		out = append(out, Citation{
+			Ref: fmt.Sprintf("K%d", len(out)+1), DocID: doc.ID, ChunkID: c.ID, Title: doc.Title, Heading: c.Heading,
+			Source: doc.Source, AnalysisID: doc.AnalysisID, Score: math.Round(scores[id]*1000) / 1000,
+			Snippet: truncateRunes(c.Content, maxCitationSnippet), content: c.Content,
+		})
+	}
+	return out, nil
+}
+
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
+
+// knowledgeQuery is what the knowledge base is searched with: the question,
+// the query and the messages of the first log rows
+func knowledgeQuery(prompt string, in AnalysisInput) string {
+	var sb strings.Builder
+	sb.WriteString(prompt + "\n" + in.Query + "\n")
+	for i, row := range in.Logs {
+		if i >= maxKnowledgeLogRows {
+			break
+		}
+		sb.WriteString(evidenceMessage(row) + "\n")
+	}
+	return sb.String()
+}
+
+// withKnowledge retrieves the excerpts for an analysis; the knowledge base is
+// optional, so failures are only logged
+func (s *AIService) withKnowledge(in AnalysisInput, prompt string) AnalysisInput {
+	cits, err := s.SearchKnowledge(knowledgeQuery(prompt, in), knowledgeTopK)
+	if err != nil {
+		utils.GetLogger().Warn("knowledge search failed", zap.Error(err))
+	}
+	in.knowledge = cits
+	return in
+}
+
+// knowledgePrompt lists the excerpts for the system prompt
+func knowledgePrompt(cits []Citation) string {
+	var sb strings.Builder
+	sb.WriteString("Excerpts from our own runbooks and past incidents. Prefer them over general advice when they apply and cite them inline as [K1], [K2], ...; ignore excerpts that do not apply.\n")
+	for _, c := range cits {
+		title := c.Title
+		if c.Heading != "" {
+			title += " › " + c.Heading
+		}
+		sb.WriteString(fmt.Sprintf("\n[%s] %s\n%s\n", c.Ref, title, truncateRunes(c.content, maxSnippetChars)))
+	}
+	return sb.String()
+}
+
+// citationsText lists the cited documents for notifications
+func citationsText(cits []Citation) string {
+	if len(cits) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\nReferences:")
+	for _, c := range cits {
+		sb.WriteString("\n[" + c.Ref + "] " + c.Title)
+		if c.Heading != "" {
+			sb.WriteString(" › " + c.Heading)
+		}
+	}
+	return sb.String()
+}
+
+// marshalCitations stores citations as JSON text, empty when there are none
+func marshalCitations(cits []Citation) string {
+	if len(cits) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(cits)
+	return string(b)
+}
+
+// ResolveAnalysis stores a structured analysis with how the incident was
+// resolved in the knowledge base, so repeat incidents retrieve it. Resolving
+// it again replaces the document.
+func (s *AIService) ResolveAnalysis(id, userID uint, resolution string) (*model.KnowledgeDoc, error) {
+	rec, err := s.GetAnalysis(id)
+	if err != nil {
+		return nil, err
+	}
+	a := rec.Analysis
+	if a == nil {
+		return nil, fmt.Errorf("analysis %d has no valid result", id)
+	}
+	// One section, so an incident is retrieved as a whole
+	var sb strings.Builder
+	sb.WriteString(a.Summary + "\n\nSeverity: " + a.Severity + "\n")
+	if len(a.AffectedServices) > 0 {
+		sb.WriteString("Affected services: " + strings.Join(a.AffectedServices, ", ") + "\n")
+	}
+	sb.WriteString("Root cause: " + a.RootCause + "\n")
+	for _, e := range a.Evidence {
+		sb.WriteString("Evidence: " + e.Message + " (" + e.Reason + ")\n")
+	}
+	for _, act := range a.Actions {
+		sb.WriteString("Action: " + act + "\n")
+	}
+	if r := strings.TrimSpace(resolution); r != "" {
+		sb.WriteString("Resolution: " + r + "\n")
+	}
+
+	doc := model.KnowledgeDoc{}
+	database.GetDB().Where("source = ? AND analysis_id = ?", KnowledgeAnalysis, id).Limit(1).Find(&doc)
+	doc.Title = truncateRunes(fmt.Sprintf("Incident #%d: %s", id, a.Summary), 120)
+	doc.Source, doc.AnalysisID, doc.Content = KnowledgeAnalysis, id, sb.String()
+	if doc.CreatedBy == 0 {
+		doc.CreatedBy = userID
+	}
+	if err := s.SaveKnowledgeDoc(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
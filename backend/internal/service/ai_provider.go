@@ -0,0 +1,501 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ailap-backend/internal/model"
+)
+
+// ChatRequest is a provider neutral chat call
+type ChatRequest struct {
+	Messages    []map[string]string // role: system, user, assistant
+	MaxTokens   int
+	Temperature float64
+	Stream      bool
+}
+
+// Usage is the token count a provider reports for a call; zero when unknown
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// add keeps the non-zero counts of u, streams report them in pieces
+func (u *Usage) add(o Usage) {
+	if o.PromptTokens > 0 {
+		u.PromptTokens = o.PromptTokens
+	}
+	if o.CompletionTokens > 0 {
+		u.CompletionTokens = o.CompletionTokens
+	}
+}
+
+// ChatProvider maps chat calls onto one vendor API: endpoint, auth headers,
+// request body and response / stream decoding.
+type ChatProvider interface {
+	// NewRequest builds the HTTP request for the model config
+	NewRequest(ctx context.Context, cfg *model.MLModel, req ChatRequest) (*http.Request, error)
+	// ParseResponse extracts the reply text and usage of a non-streaming response
+	ParseResponse(body []byte) (string, Usage, error)
+	// ParseStreamLine extracts the text delta and any usage of one line of a
+	// streaming response; done reports the end of the stream
+	ParseStreamLine(line string) (delta string, usage Usage, done bool)
+	// RequiresKey reports whether an API key must be configured
+	RequiresKey() bool
+}
+
+var providers = map[string]ChatProvider{}
+
+// RegisterProvider makes a chat provider available under the given names
+func RegisterProvider(p ChatProvider, names ...string) {
+	for _, name := range names {
+		providers[name] = p
+	}
+}
+
+// GetProvider returns the adapter for MLModel.Provider. Unknown providers
+// (openai, deepseek, qwen, ...) use the OpenAI compatible chat/completions API.
+func GetProvider(name string) ChatProvider {
+	if p, ok := providers[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return p
+	}
+	return providers["openai"]
+}
+
+func init() {
+	RegisterProvider(&openAIProvider{}, "openai", "deepseek", "qwen")
+	RegisterProvider(&azureOpenAIProvider{}, "azure", "azure-openai")
+	RegisterProvider(&ollamaProvider{}, "ollama")
+	RegisterProvider(&anthropicProvider{}, "anthropic", "claude")
+	RegisterProvider(&geminiProvider{}, "gemini", "google")
+}
+
+// ValidateModelConfig checks the fields the provider needs
+func ValidateModelConfig(cfg *model.MLModel) error {
+	p := GetProvider(cfg.Provider)
+	if strings.TrimSpace(cfg.Model) == "" {
+		return fmt.Errorf("incomplete model config")
+	}
+	if p.RequiresKey() && strings.TrimSpace(cfg.APIKey) == "" {
+		return fmt.Errorf("incomplete model config")
+	}
+	if _, ok := p.(*openAIProvider); ok && strings.TrimSpace(cfg.APIBase) == "" {
+		return fmt.Errorf("incomplete model config")
+	}
+	return nil
+}
+
+// jsonRequest builds a POST request with a JSON body
+func jsonRequest(ctx context.Context, endpoint string, payload interface{}) (*http.Request, error) {
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// sseData returns the payload of an SSE "data:" line
+func sseData(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "data:") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "data:")), true
+}
+
+// apiBase returns the configured base URL or the provider default
+func apiBase(cfg *model.MLModel, def string) string {
+	if base := strings.TrimSpace(cfg.APIBase); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return def
+}
+
+// ---- OpenAI compatible ----
+
+type openAIProvider struct{}
+
+// streamUsageProviders accept stream_options.include_usage
+var streamUsageProviders = map[string]bool{"openai": true, "deepseek": true, "qwen": true}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *openAIUsage) usage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+func (p *openAIProvider) RequiresKey() bool { return true }
+
+func (p *openAIProvider) NewRequest(ctx context.Context, cfg *model.MLModel, req ChatRequest) (*http.Request, error) {
+	payload := openAIPayload(cfg, req)
+	// Streams only report usage on request; limited to the known vendors since
+	// other compatible servers may reject the option
+	if req.Stream && streamUsageProviders[strings.ToLower(cfg.Provider)] {
+		payload["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	httpReq, err := jsonRequest(ctx, apiBase(cfg, "")+"/chat/completions", payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	return httpReq, nil
+}
+
+func openAIPayload(cfg *model.MLModel, req ChatRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"model":       cfg.Model,
+		"messages":    req.Messages,
+		"max_tokens":  req.MaxTokens,
+		"temperature": req.Temperature,
+		"stream":      req.Stream,
+	}
+}
+
+func (p *openAIProvider) ParseResponse(body []byte) (string, Usage, error) {
+	var obj struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &obj); err == nil && len(obj.Choices) > 0 {
+		return obj.Choices[0].Message.Content, obj.Usage.usage(), nil
+	}
+	return string(body), Usage{}, nil
+}
+
+func (p *openAIProvider) ParseStreamLine(line string) (string, Usage, bool) {
+	data, ok := sseData(line)
+	if !ok {
+		return "", Usage{}, false
+	}
+	if data == "[DONE]" {
+		return "", Usage{}, true
+	}
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return "", Usage{}, false
+	}
+	// The usage chunk comes last with no choices
+	if len(chunk.Choices) == 0 {
+		return "", chunk.Usage.usage(), false
+	}
+	return chunk.Choices[0].Delta.Content, chunk.Usage.usage(), false
+}
+
+// ---- Azure OpenAI ----
+
+// azureOpenAIProvider calls a deployment: APIBase is the resource endpoint
+// (https://{resource}.openai.azure.com) or a full deployment URL, Model the
+// deployment name. The api-version query parameter of APIBase is honoured.
+type azureOpenAIProvider struct{ openAIProvider }
+
+// azureDefaultAPIVersion is used when APIBase carries no api-version
+const azureDefaultAPIVersion = "2024-06-01"
+
+func (p *azureOpenAIProvider) NewRequest(ctx context.Context, cfg *model.MLModel, req ChatRequest) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimSpace(cfg.APIBase))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid azure endpoint: %s", cfg.APIBase)
+	}
+	q := u.Query()
+	if q.Get("api-version") == "" {
+		q.Set("api-version", azureDefaultAPIVersion)
+	}
+	u.RawQuery = q.Encode()
+	path := strings.TrimRight(u.Path, "/")
+	if !strings.Contains(path, "/deployments/") {
+		path += "/openai/deployments/" + url.PathEscape(cfg.Model)
+	}
+	if !strings.HasSuffix(path, "/chat/completions") {
+		path += "/chat/completions"
+	}
+	u.Path = path
+
+	payload := openAIPayload(cfg, req)
+	delete(payload, "model")
+	httpReq, err := jsonRequest(ctx, u.String(), payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("api-key", cfg.APIKey)
+	return httpReq, nil
+}
+
+// ---- Ollama ----
+
+// ollamaProvider uses the native /api/chat endpoint; streams are NDJSON
+type ollamaProvider struct{}
+
+func (p *ollamaProvider) RequiresKey() bool { return false }
+
+func (p *ollamaProvider) NewRequest(ctx context.Context, cfg *model.MLModel, req ChatRequest) (*http.Request, error) {
+	base := strings.TrimSuffix(apiBase(cfg, "http://localhost:11434"), "/api")
+	payload := map[string]interface{}{
+		"model":    cfg.Model,
+		"messages": req.Messages,
+		"stream":   req.Stream,
+		"options":  map[string]interface{}{"temperature": req.Temperature, "num_predict": req.MaxTokens},
+	}
+	httpReq, err := jsonRequest(ctx, base+"/api/chat", payload)
+	if err != nil {
+		return nil, err
+	}
+	// Ollama has no auth itself; a key is passed on for reverse proxies
+	if cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	return httpReq, nil
+}
+
+// ollamaChunk is a response or stream line; the last one carries the token counts
+type ollamaChunk struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool `json:"done"`
+	PromptEvalCount int  `json:"prompt_eval_count"`
+	EvalCount       int  `json:"eval_count"`
+}
+
+func (c ollamaChunk) usage() Usage {
+	return Usage{PromptTokens: c.PromptEvalCount, CompletionTokens: c.EvalCount}
+}
+
+func (p *ollamaProvider) ParseResponse(body []byte) (string, Usage, error) {
+	var obj ollamaChunk
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return "", Usage{}, err
+	}
+	return obj.Message.Content, obj.usage(), nil
+}
+
+func (p *ollamaProvider) ParseStreamLine(line string) (string, Usage, bool) {
+	var chunk ollamaChunk
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &chunk); err != nil {
+		return "", Usage{}, false
+	}
+	return chunk.Message.Content, chunk.usage(), chunk.Done
+}
+
+// ---- Anthropic ----
+
+// anthropicProvider uses the Messages API; system messages go to the
+// top-level "system" field
+type anthropicProvider struct{}
+
+const anthropicVersion = "2023-06-01"
+
+func (p *anthropicProvider) RequiresKey() bool { return true }
+
+func (p *anthropicProvider) NewRequest(ctx context.Context, cfg *model.MLModel, req ChatRequest) (*http.Request, error) {
+	base := strings.TrimSuffix(apiBase(cfg, "https://api.anthropic.com"), "/v1")
+	var system []string
+	messages := make([]map[string]string, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		if m["role"] == "system" {
+			system = append(system, m["content"])
+			continue
+		}
+		messages = append(messages, map[string]string{"role": m["role"], "content": m["content"]})
+	}
+	payload := map[string]interface{}{
+		"model":       cfg.Model,
+		"messages":    messages,
+		"max_tokens":  req.MaxTokens,
+		"temperature": req.Temperature,
+		"stream":      req.Stream,
+	}
+	if len(system) > 0 {
+		payload["system"] = strings.Join(system, "\n\n")
+	}
+	httpReq, err := jsonRequest(ctx, base+"/v1/messages", payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-api-key", cfg.APIKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	return httpReq, nil
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u anthropicUsage) usage() Usage {
+	return Usage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens}
+}
+
+func (p *anthropicProvider) ParseResponse(body []byte) (string, Usage, error) {
+	var obj struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage anthropicUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return "", Usage{}, err
+	}
+	var sb strings.Builder
+	for _, c := range obj.Content {
+		if c.Type == "text" {
+			sb.WriteString(c.Text)
+		}
+	}
+	return sb.String(), obj.Usage.usage(), nil
+}
+
+// ParseStreamLine reads input tokens from message_start and output tokens
+// from message_delta
+func (p *anthropicProvider) ParseStreamLine(line string) (string, Usage, bool) {
+	data, ok := sseData(line)
+	if !ok {
+		return "", Usage{}, false
+	}
+	var event struct {
+		Type  string `json:"type"`
+		Delta struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"delta"`
+		Message struct {
+			Usage anthropicUsage `json:"usage"`
+		} `json:"message"`
+		Usage anthropicUsage `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return "", Usage{}, false
+	}
+	switch event.Type {
+	case "message_start":
+		return "", event.Message.Usage.usage(), false
+	case "content_block_delta":
+		return event.Delta.Text, Usage{}, false
+	case "message_delta":
+		return "", Usage{CompletionTokens: event.Usage.OutputTokens}, false
+	case "message_stop":
+		return "", Usage{}, true
+	}
+	return "", Usage{}, false
+}
+
+// ---- Gemini ----
+
+// geminiProvider uses generateContent / streamGenerateContent of the
+// Generative Language API; assistant turns use the "model" role
+type geminiProvider struct{}
+
+func (p *geminiProvider) RequiresKey() bool { return true }
+
+func (p *geminiProvider) NewRequest(ctx context.Context, cfg *model.MLModel, req ChatRequest) (*http.Request, error) {
+	base := apiBase(cfg, "https://generativelanguage.googleapis.com/v1beta")
+	if !strings.Contains(base, "/v1") {
+		base += "/v1beta"
+	}
+	endpoint := base + "/models/" + url.PathEscape(cfg.Model) + ":generateContent"
+	if req.Stream {
+		endpoint = base + "/models/" + url.PathEscape(cfg.Model) + ":streamGenerateContent?alt=sse"
+	}
+
+	var system []map[string]string
+	contents := make([]map[string]interface{}, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		part := map[string]string{"text": m["content"]}
+		switch m["role"] {
+		case "system":
+			system = append(system, part)
+		case "assistant":
+			contents = append(contents, map[string]interface{}{"role": "model", "parts": []map[string]string{part}})
+		default:
+			contents = append(contents, map[string]interface{}{"role": "user", "parts": []map[string]string{part}})
+		}
+	}
+	payload := map[string]interface{}{
+		"contents":         contents,
+		"generationConfig": map[string]interface{}{"temperature": req.Temperature, "maxOutputTokens": req.MaxTokens},
+	}
+	if len(system) > 0 {
+		payload["systemInstruction"] = map[string]interface{}{"parts": system}
+	}
+	httpReq, err := jsonRequest(ctx, endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-goog-api-key", cfg.APIKey)
+	return httpReq, nil
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func (r geminiResponse) usage() Usage {
+	return Usage{PromptTokens: r.UsageMetadata.PromptTokenCount, CompletionTokens: r.UsageMetadata.CandidatesTokenCount}
+}
+
+func (r geminiResponse) text() string {
+	var sb strings.Builder
+	if len(r.Candidates) > 0 {
+		for _, part := range r.Candidates[0].Content.Parts {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
+
+func (p *geminiProvider) ParseResponse(body []byte) (string, Usage, error) {
+	var obj geminiResponse
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return "", Usage{}, err
+	}
+	return obj.text(), obj.usage(), nil
+}
+
+// ParseStreamLine: every chunk carries the running usage totals
+func (p *geminiProvider) ParseStreamLine(line string) (string, Usage, bool) {
+	data, ok := sseData(line)
+	if !ok {
+		return "", Usage{}, false
+	}
+	var obj geminiResponse
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		return "", Usage{}, false
+	}
+	return obj.text(), obj.usage(), false
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ailap-backend/internal/model"
+)
+
+// GeneratedQuery is the result of a natural-language to query translation
+type GeneratedQuery struct {
+	Query string `json:"query"`
+	// Lookback is the time range the request asked for, e.g. "1h"; empty when unspecified
+	Lookback string `json:"lookback,omitempty"`
+	Start    string `json:"start,omitempty"` // unix ns derived from Lookback
+	End      string `json:"end,omitempty"`
+	// Valid reports whether the dry run against the datasource succeeded
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+	// Fields are the label / field names that were offered to the model
+	Fields []string `json:"fields"`
+	Model  string   `json:"model,omitempty"` // model that answered
+}
+
+// queryLanguageHints describes each engine's query language for the model
+var queryLanguageHints = map[string]string{
+	"loki":          `LogQL (Grafana Loki). A query starts with a stream selector such as {app="payment"}, followed by line filters (|= "text", |~ "regex", != "text") and label filters (| level="error"). Only use labels that exist.`,
+	"elasticsearch": `Lucene query_string syntax (Elasticsearch). Use field:value, field:"phrase", AND / OR / NOT and parentheses. Only use fields that exist; free text searches all fields.`,
+	"victorialogs":  `LogsQL (VictoriaLogs). Words and "phrases" match the message; field:value / field:="exact" / field:~"regex" match fields; combine with and / or / not and parentheses. Do not add _time filters.`,
+}
+
+// maxPromptFields caps how many discovered field names go into the prompt
+const maxPromptFields = 150
+
+// codeFencePattern strips markdown code fences around a model reply
+var codeFencePattern = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*(.*?)\\s*```$")
+
+// GenerateQuery translates a plain-language request into a query for the
+// engine using the default model. The model is given the datasource's label
+// and field names, and the result is validated with a dry run; when the dry run
+// fails the model gets one chance to correct the query.
+func (s *AIService) GenerateQuery(ctx context.Context, engine, datasourceID, request string) (*GeneratedQuery, error) {
+	hint, ok := queryLanguageHints[engine]
+	if !ok {
+		return nil, fmt.Errorf("unsupported engine: %s", engine)
+	}
+	request = strings.TrimSpace(request)
+	if request == "" {
+		return nil, fmt.Errorf("request is required")
+	}
+	if _, err := modelChain(); err != nil {
+		return nil, err
+	}
+
+	fields, _ := s.logService.Labels(ctx, engine, datasourceID)
+	if len(fields) > maxPromptFields {
+		fields = fields[:maxPromptFields]
+	}
+	if fields == nil {
+		fields = []string{}
+	}
+
+	sysPrompt := "You translate plain-language log search requests into queries. Target language: " + hint +
+		"\nReply with JSON only: {\"query\": \"<query>\", \"lookback\": \"<duration such as 15m, 1h, 24h, or empty>\"}. " +
+		"Put the time range in lookback, never inside the query."
+	if len(fields) > 0 {
+		sysPrompt += "\nAvailable labels / fields: " + strings.Join(fields, ", ")
+	}
+	messages := []map[string]string{
+		{"role": "system", "content": sysPrompt},
+		{"role": "user", "content": request},
+	}
+
+	var out *GeneratedQuery
+	chatCtx := WithRedactionSource(WithUsageScope(ctx, UsageScope{Feature: FeatureGenerateQuery}), datasourceID)
+	for attempt := 0; attempt < 2; attempt++ {
+		reply, cfg, err := s.chat(chatCtx, func(cfg *model.MLModel) ChatRequest { return chatRequest(cfg, messages, 0) })
+		if err != nil {
+			return nil, err
+		}
+		out = parseGeneratedQuery(reply)
+		out.Model = cfg.Name
+		out.Fields = fields
+		if out.Query == "" {
+			out.Error = "model returned an empty query"
+		} else if err := s.dryRun(ctx, engine, datasourceID, out); err != nil {
+			out.Error = err.Error()
+		} else {
+			out.Valid, out.Error = true, ""
+			return out, nil
+		}
+		messages = append(messages,
+			map[string]string{"role": "assistant", "content": reply},
+			map[string]string{"role": "user", "content": "The query failed: " + out.Error + "\nReturn a corrected query in the same JSON format."},
+		)
+	}
+	return out, nil
+}
+
+// parseGeneratedQuery reads the JSON reply, falling back to treating the whole
+// reply as the query when the model ignored the format
+func parseGeneratedQuery(reply string) *GeneratedQuery {
+	reply = strings.TrimSpace(reply)
+	if m := codeFencePattern.FindStringSubmatch(reply); m != nil {
+		reply = strings.TrimSpace(m[1])
+	}
+	var parsed struct {
+		Query    string `json:"query"`
+		Lookback string `json:"lookback"`
+	}
+	if err := json.Unmarshal([]byte(reply), &parsed); err == nil {
+		return &GeneratedQuery{Query: strings.TrimSpace(parsed.Query), Lookback: strings.TrimSpace(parsed.Lookback)}
+	}
+	return &GeneratedQuery{Query: reply}
+}
+
+// dryRun executes the query with a single row limit over the requested lookback
+func (s *AIService) dryRun(ctx context.Context, engine, datasourceID string, q *GeneratedQuery) error {
+	now := time.Now()
+	lookback := time.Hour
+	if d, err := time.ParseDuration(q.Lookback); err == nil && d > 0 {
+		lookback = d
+	} else {
+		q.Lookback = ""
+	}
+	q.Start = strconv.FormatInt(now.Add(-lookback).UnixNano(), 10)
+	q.End = strconv.FormatInt(now.UnixNano(), 10)
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	_, err := s.logService.ExecuteQuery(ctx, engine, datasourceID, QueryRequest{Query: q.Query, Start: q.Start, End: q.End, Limit: 1})
+	return err
+}
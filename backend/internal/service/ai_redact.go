@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+	"ailap-backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// Kinds of the built-in redaction detectors, used in tokens and audit records
+const (
+	RedactEmail      = "EMAIL"
+	RedactPhone      = "PHONE"
+	RedactIDCard     = "ID_CARD"
+	RedactIP         = "IP"
+	RedactJWT        = "JWT"
+	RedactAPIKey     = "API_KEY"
+	RedactCreditCard = "CREDIT_CARD"
+)
+
+// redactionDetector finds one kind of sensitive value. Only submatch group is
+// replaced (0: the whole match); valid, when set, rejects false positives.
+type redactionDetector struct {
+	kind  string
+	re    *regexp.Regexp
+	group int
+	valid func(v string) bool
+}
+
+// builtinDetectors run in this order after the datasource's custom rules, the
+// more specific ones first so e.g. a JWT is not taken apart as an API key
+var builtinDetectors = []redactionDetector{
+	{kind: RedactJWT, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]*`)},
+	{kind: RedactAPIKey, re: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})`)},
+	{kind: RedactAPIKey, group: 1, re: regexp.MustCompile(`(?i)\b(?:api[_-]?key|access[_-]?key|secret|(?:access[_-]?|refresh[_-]?)?token|passw(?:or)?d|authorization)["']?\s*[:=]\s*["']?(?:Bearer\s+|Basic\s+)?([^\s"',;&{}\[\]]{8,})`)},
+	{kind: RedactEmail, re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)},
+	{kind: RedactIDCard, re: regexp.MustCompile(`\b[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`), valid: validIDCard},
+	{kind: RedactCreditCard, re: regexp.MustCompile(`\b(?:4\d{3}|5[1-5]\d{2}|2[2-7]\d{2}|3[47]\d{2}|6\d{3})(?:[ -]?\d{4}){2}[ -]?\d{1,7}\b`), valid: validCardNumber},
+	{kind: RedactPhone, re: regexp.MustCompile(`(?:\+86[ -]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[ -]?\(?\d{1,4}\)?[ -]?\d{3,4}[ -]?\d{3,4}\b`)},
+	{kind: RedactIP, re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b|\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`)},
+}
+
+// validIDCard checks the GB 11643 check digit of an 18 digit ID card number
+func validIDCard(v string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(v[i]-'0') * w
+	}
+	return "10X98765432"[sum%11] == strings.ToUpper(v[17:])[0]
+}
+
+// validCardNumber applies the Luhn check to 13 to 19 digits
+func validCardNumber(v string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(v)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-i)%2 == 0 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// RedactionRule is a custom detector stored in a datasource's config under
+// "redactionRules"; Name becomes the token kind
+type RedactionRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+var nonKindChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// ValidateRedactionRules checks the custom rules of a datasource config
+func ValidateRedactionRules(v interface{}) error {
+	_, err := parseRedactionRules(v)
+	return err
+}
+
+// parseRedactionRules compiles the custom rules of a datasource config value
+// (nil, a list of rules or its JSON text). Rules without a pattern are skipped.
+func parseRedactionRules(v interface{}) ([]redactionDetector, error) {
+	var rules []RedactionRule
+	switch raw := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.TrimSpace(raw) == "" {
+			return nil, nil
+		}
+		if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+			return nil, fmt.Errorf("invalid redaction rules: %w", err)
+		}
+	default:
+		b, _ := json.Marshal(raw)
+		if err := json.Unmarshal(b, &rules); err != nil {
+			return nil, fmt.Errorf("invalid redaction rules: %w", err)
+		}
+	}
+	var out []redactionDetector
+	for _, r := range rules {
+		if strings.TrimSpace(r.Pattern) == "" {
+			continue
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule %q: %w", r.Name, err)
+		}
+		kind := strings.Trim(nonKindChars.ReplaceAllString(strings.ToUpper(r.Name), "_"), "_")
+		if kind == "" {
+			kind = "CUSTOM"
+		}
+		out = append(out, redactionDetector{kind: kind, re: re})
+	}
+	return out, nil
+}
+
+// Redactor replaces sensitive values with stable tokens such as [EMAIL_1].
+// The same value always gets the same token, so the model can still correlate
+// rows, and Restore puts the values back into the reply locally.
+type Redactor struct {
+	detectors []redactionDetector
+	mu        sync.Mutex
+	tokens    map[string]string // value -> token
+	values    map[string]string // token -> value
+	counts    map[string]int    // kind -> distinct values
+}
+
+// NewRedactor runs the custom detectors before the built-in ones
+func NewRedactor(custom []redactionDetector) *Redactor {
+	return &Redactor{
+		detectors: append(append([]redactionDetector{}, custom...), builtinDetectors...),
+		tokens:    map[string]string{},
+		values:    map[string]string{},
+		counts:    map[string]int{},
+	}
+}
+
+func (r *Redactor) token(kind, value string) string {
+	if t, ok := r.tokens[value]; ok {
+		return t
+	}
+	r.counts[kind]++
+	t := "[" + kind + "_" + strconv.Itoa(r.counts[kind]) + "]"
+	r.tokens[value], r.values[t] = t, value
+	return t
+}
+
+// Redact tokenises every detected value in text
+func (r *Redactor) Redact(text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.detectors {
+		matches := d.re.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		var sb strings.Builder
+		last := 0
+		for _, m := range matches {
+			if 2*d.group+1 >= len(m) || m[2*d.group] < 0 {
+				continue
+			}
+			start, end := m[2*d.group], m[2*d.group+1]
+			value := text[start:end]
+			if start < last || value == "" || (d.valid != nil && !d.valid(value)) {
+				continue
+			}
+			sb.WriteString(text[last:start])
+			sb.WriteString(r.token(d.kind, value))
+			last = end
+		}
+		sb.WriteString(text[last:])
+		text = sb.String()
+	}
+	return text
+}
+
+var redactionTokenPattern = regexp.MustCompile(`\[[A-Z][A-Z0-9_]*_\d+\]`)
+
+// Restore replaces the tokens in a model reply with the original values;
+// tokens the model made up are left as they are
+func (r *Redactor) Restore(text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.values) == 0 {
+		return text
+	}
+	return redactionTokenPattern.ReplaceAllStringFunc(text, func(t string) string {
+		if v, ok := r.values[t]; ok {
+			return v
+		}
+		return t
+	})
+}
+
+// Findings counts the distinct values redacted per kind
+func (r *Redactor) Findings() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]int, len(r.counts))
+	for k, v := range r.counts {
+		out[k] = v
+	}
+	return out
+}
+
+// apply redacts every message of a request
+func (r *Redactor) apply(req ChatRequest) ChatRequest {
+	messages := make([]map[string]string, len(req.Messages))
+	for i, m := range req.Messages {
+		out := make(map[string]string, len(m))
+		for k, v := range m {
+			out[k] = v
+		}
+		out["content"] = r.Redact(m["content"])
+		messages[i] = out
+	}
+	req.Messages = messages
+	return req
+}
+
+// maxTokenLength bounds how much of a streamed reply is held back while a
+// token may still be incomplete
+const maxTokenLength = 48
+
+// restoreStream wraps onDelta so streamed text is restored before it is
+// forwarded. A trailing "[" that may start a token is held back until the
+// token is complete; flush sends what is left at the end of the stream.
+func (r *Redactor) restoreStream(onDelta func(delta string) error) (write func(delta string) error, flush func() error) {
+	var pending string
+	write = func(delta string) error {
+		pending += delta
+		cut := len(pending)
+		if i := strings.LastIndex(pending, "["); i >= 0 && !strings.Contains(pending[i:], "]") && len(pending)-i < maxTokenLength {
+			cut = i
+		}
+		if cut == 0 {
+			return nil
+		}
+		out := r.Restore(pending[:cut])
+		pending = pending[cut:]
+		return onDelta(out)
+	}
+	flush = func() error {
+		if pending == "" {
+			return nil
+		}
+		out := r.Restore(pending)
+		pending = ""
+		return onDelta(out)
+	}
+	return write, flush
+}
+
+type redactionSourceKey struct{}
+
+// WithRedactionSource selects the datasource whose custom redaction rules
+// apply to the model calls made with ctx
+func WithRedactionSource(ctx context.Context, datasourceID string) context.Context {
+	return context.WithValue(ctx, redactionSourceKey{}, datasourceID)
+}
+
+// redactorFor builds the redactor of one model call. Broken custom rules of a
+// datasource are logged and skipped, the built-in detectors always apply.
+func redactorFor(ctx context.Context) *Redactor {
+	id, _ := ctx.Value(redactionSourceKey{}).(string)
+	if id == "" {
+		return NewRedactor(nil)
+	}
+	var ds model.DataSource
+	if err := database.GetDB().First(&ds, "id = ?", id).Error; err != nil {
+		return NewRedactor(nil)
+	}
+	var cfg map[string]interface{}
+	_ = json.Unmarshal([]byte(ds.Config), &cfg)
+	custom, err := parseRedactionRules(cfg["redactionRules"])
+	if err != nil {
+		utils.GetLogger().Warn("datasource redaction rules ignored", zap.String("datasource_id", id), zap.Error(err))
+	}
+	return NewRedactor(custom)
+}
+
+// audit stores what the redactor replaced in the calls of ctx. Only kinds and
+// counts are kept, never the values.
+func (r *Redactor) audit(ctx context.Context, cfg *model.MLModel) {
+	findings := r.Findings()
+	if len(findings) == 0 {
+		return
+	}
+	scope := usageScopeOf(ctx)
+	id, _ := ctx.Value(redactionSourceKey{}).(string)
+	total := 0
+	for _, n := range findings {
+		total += n
+	}
+	b, _ := json.Marshal(findings)
+	rec := model.AIRedaction{UserID: scope.UserID, MonitorID: scope.MonitorID, Feature: scope.Feature, DatasourceID: id, Findings: string(b), Total: total}
+	if cfg != nil {
+		rec.ModelID, rec.ModelName = cfg.ID, cfg.Name
+	}
+	if err := database.GetDB().Create(&rec).Error; err != nil {
+		utils.GetLogger().Error("store ai redaction audit failed", zap.Error(err))
+	}
+}
+
+// PreviewRedaction redacts text with the built-in detectors and the given
+// custom rules, used to try rules before saving a datasource
+func (s *AIService) PreviewRedaction(text string, rules interface{}) (string, map[string]int, error) {
+	custom, err := parseRedactionRules(rules)
+	if err != nil {
+		return "", nil, err
+	}
+	r := NewRedactor(custom)
+	return r.Redact(text), r.Findings(), nil
+}
+
+// ListRedactions returns the latest redaction audit records, optionally of one
+// user or monitor
+func (s *AIService) ListRedactions(userID, monitorID uint, limit int) ([]model.AIRedaction, error) {
+	q := database.GetDB().Order("id desc").Limit(chooseInt(limit, 100))
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	if monitorID != 0 {
+		q = q.Where("monitor_id = ?", monitorID)
+	}
+	var items []model.AIRedaction
+	err := q.Find(&items).Error
+	return items, err
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"ailap-backend/internal/model"
+)
+
+// Output formats of an AnalysisRole
+const (
+	OutputMarkdown = "markdown"
+	OutputText     = "text"
+	OutputJSON     = "json"
+)
+
+// AnalysisRole is a persona stored in MLModel.Roles. SystemPrompt is a
+// text/template over PromptData, e.g. "Logs of {{.Datasource}} ({{.TimeRange}})".
+type AnalysisRole struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	SystemPrompt string `json:"systemPrompt"`
+	Language     string `json:"language"`     // zh, en, ...; empty means zh
+	OutputFormat string `json:"outputFormat"` // markdown (default), text, json
+}
+
+// defaultRoleName selects the built-in role
+const defaultRoleName = "default"
+
+// analysisSystemPrompt is the system prompt of the built-in role
+const analysisSystemPrompt = "你是资深的日志分析助手。根据提供的日志片段，结合用户问题，用中文给出要点式分析：1) 现象与范围，2) 可能原因，3) 进一步的验证建议，4) 缓解或修复步骤。"
+
+var defaultRole = AnalysisRole{Name: defaultRoleName, Description: "内置日志分析助手", SystemPrompt: analysisSystemPrompt, Language: "zh", OutputFormat: OutputMarkdown}
+
+// PromptData are the variables of a role's system prompt
+type PromptData struct {
+	Logs       string // packed log context, see PackLogContext
+	Query      string
+	Datasource string
+	TimeRange  string
+}
+
+// languageInstructions and formatInstructions are appended to a role's prompt
+var languageInstructions = map[string]string{
+	"zh": "请用中文回答。",
+	"en": "Answer in English.",
+}
+
+var formatInstructions = map[string]string{
+	OutputMarkdown: "Format the answer as Markdown.",
+	OutputText:     "Answer in plain text without Markdown.",
+	OutputJSON:     "Reply with a single JSON object and nothing else.",
+}
+
+// logsHeading introduces appended logs, per language
+var logsHeading = map[string]string{"zh": "日志摘要", "en": "Logs"}
+
+// ParseRoles decodes MLModel.Roles, dropping unnamed entries
+func ParseRoles(raw string) []AnalysisRole {
+	var roles []AnalysisRole
+	if err := json.Unmarshal([]byte(raw), &roles); err != nil {
+		return nil
+	}
+	out := roles[:0]
+	for _, r := range roles {
+		r.Name = strings.TrimSpace(r.Name)
+		if r.Name != "" {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Roles lists the built-in role followed by the roles of the model chain; a
+// name defined on several models resolves to the first one
+func (s *AIService) Roles() ([]AnalysisRole, error) {
+	chain, err := modelChain()
+	if err != nil {
+		return nil, err
+	}
+	return chainRoles(chain), nil
+}
+
+func chainRoles(chain []*model.MLModel) []AnalysisRole {
+	roles := []AnalysisRole{defaultRole}
+	seen := map[string]bool{defaultRoleName: true}
+	for _, cfg := range chain {
+		for _, r := range ParseRoles(cfg.Roles) {
+			if !seen[r.Name] {
+				seen[r.Name] = true
+				roles = append(roles, r)
+			}
+		}
+	}
+	return roles
+}
+
+// rolePrompt is a role with its parsed system prompt template
+type rolePrompt struct {
+	AnalysisRole
+	tmpl *template.Template
+}
+
+// resolveRole finds a role by name (empty selects the built-in one) and
+// parses its template
+func resolveRole(name string) (*rolePrompt, error) {
+	name = strings.TrimSpace(name)
+	role := defaultRole
+	if name != "" && name != defaultRoleName {
+		chain, err := modelChain()
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, r := range chainRoles(chain) {
+			if r.Name == name {
+				role, found = r, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("role not found: %s", name)
+		}
+	}
+	if strings.TrimSpace(role.SystemPrompt) == "" {
+		role.SystemPrompt = analysisSystemPrompt
+	}
+	tmpl, err := template.New(role.Name).Option("missingkey=zero").Parse(role.SystemPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template of role %s: %w", role.Name, err)
+	}
+	return &rolePrompt{AnalysisRole: role, tmpl: tmpl}, nil
+}
+
+// language defaults to Chinese like the built-in prompt
+func (r *rolePrompt) language() string {
+	if r.Language == "" {
+		return "zh"
+	}
+	return r.Language
+}
+
+// defaultPrompts is the question asked when the user gives none
+var defaultPrompts = map[string]string{
+	"zh": "请基于下列日志片段定位可能的问题并给出建议。",
+	"en": "Find the likely problems in the logs below and suggest next steps.",
+}
+
+func (r *rolePrompt) defaultPrompt() string {
+	if p, ok := defaultPrompts[r.language()]; ok {
+		return p
+	}
+	return defaultPrompts["en"]
+}
+
+// render executes the template and appends the language and output format
+// instructions. Logs the template doesn't place are appended at the end.
+func (r *rolePrompt) render(data PromptData) string {
+	var sb strings.Builder
+	if err := r.tmpl.Execute(&sb, data); err != nil {
+		sb.Reset()
+		sb.WriteString(r.SystemPrompt)
+	}
+	lang := r.language()
+	instr, ok := languageInstructions[lang]
+	if !ok {
+		instr = "Answer in " + lang + "."
+	}
+	sb.WriteString("\n" + instr)
+	if f, ok := formatInstructions[r.OutputFormat]; ok {
+		sb.WriteString(" " + f)
+	}
+	if data.Logs != "" && !strings.Contains(r.SystemPrompt, ".Logs") {
+		heading, ok := logsHeading[lang]
+		if !ok {
+			heading = logsHeading["en"]
+		}
+		sb.WriteString("\n\n" + heading + ":\n" + data.Logs)
+	}
+	return sb.String()
+}
@@ -1,101 +1,219 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
+	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 
-	"ailap-backend/internal/database"
 	"ailap-backend/internal/model"
 	"ailap-backend/internal/utils"
 
 	"go.uber.org/zap"
 )
 
-type AIService struct{}
+type AIService struct {
+	logService *LogService
+}
 
 func NewAIService() *AIService {
-	return &AIService{}
+	return &AIService{logService: NewLogService()}
+}
+
+// AnalysisInput describes one log analysis. Role selects a persona (see
+// AnalysisRole); Query, Datasource and TimeRange fill its prompt template.
+// DatasourceID selects the custom redaction rules applied before the logs
+// leave the server. Relevant knowledge base excerpts are added to the prompt.
+type AnalysisInput struct {
+	Role         string
+	Prompt       string
+	Logs         []interface{}
+	Query        string
+	Datasource   string
+	DatasourceID string
+	TimeRange    string
+	knowledge    []Citation // knowledge base excerpts, see withKnowledge
 }
 
-// Analyze performs analysis on provided logs
-func (s *AIService) Analyze(prompt string, logs []interface{}) (string, error) {
-	// fetch default model
-	var cfg model.MLModel
-	if err := database.GetDB().Where("is_default = ? AND enabled = ?", true, true).First(&cfg).Error; err != nil {
-		return "", fmt.Errorf("no enabled default model found")
+// systemPrompt renders the role for cfg with the logs packed into its budget,
+// followed by the knowledge base excerpts
+func (s *AIService) systemPrompt(cfg *model.MLModel, role *rolePrompt, in AnalysisInput) string {
+	data := PromptData{Query: in.Query, Datasource: in.Datasource, TimeRange: in.TimeRange}
+	if len(in.Logs) > 0 {
+		data.Logs = s.logSnippet(cfg, in.Logs, datasourceMapping(in.DatasourceID))
 	}
-	if strings.TrimSpace(cfg.APIBase) == "" || strings.TrimSpace(cfg.APIKey) == "" || strings.TrimSpace(cfg.Model) == "" {
-		return "", fmt.Errorf("incomplete model config")
+	prompt := role.render(data)
+	if len(in.knowledge) > 0 {
+		prompt += "\n\n" + knowledgePrompt(in.knowledge)
 	}
+	return prompt
+}
 
-	// prepare logs snippet
-	var buf bytes.Buffer
-	limit := 8000
-	for i, row := range logs {
-		b, _ := json.Marshal(row)
-		if buf.Len()+len(b)+1 > limit {
-			fmt.Fprintf(&buf, "\n... (%d more) ...", len(logs)-i)
-			break
-		}
-		if buf.Len() > 0 {
-			buf.WriteByte('\n')
-		}
-		buf.Write(b)
+// logSnippet packs the logs into the model's context budget and records
+// what had to be omitted
+func (s *AIService) logSnippet(cfg *model.MLModel, logs []interface{}, mapping FieldMapping) string {
+	packed := s.PackLogContext(logs, contextBudget(cfg), mapping)
+	if packed.OmittedLines > 0 {
+		utils.GetLogger().Info("ai log context truncated",
+			zap.Int("rows", packed.TotalRows), zap.Int("included_lines", packed.IncludedLines),
+			zap.Int("omitted_lines", packed.OmittedLines), zap.Int("omitted_rows", packed.OmittedRows))
+	}
+	return packed.Text
+}
+
+// ProviderError is a non-2xx answer of a model provider
+type ProviderError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *ProviderError) Error() string { return "provider error: " + e.Body }
+
+// chatRequest fills in the model's max tokens
+func chatRequest(cfg *model.MLModel, messages []map[string]string, temperature float64) ChatRequest {
+	return ChatRequest{Messages: messages, MaxTokens: chooseInt(cfg.MaxTokens, 512), Temperature: temperature}
+}
+
+// chat sends a chat completion through the fallback chain (see callModels);
+// build makes the request for each model tried. Sensitive values are
+// tokenised before the request leaves and restored in the reply.
+func (s *AIService) chat(ctx context.Context, build func(cfg *model.MLModel) ChatRequest) (string, *model.MLModel, error) {
+	red := redactorFor(ctx)
+	reply, cfg, err := s.callModels(ctx, func(ctx context.Context, cfg *model.MLModel) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, modelTimeout(cfg))
+		defer cancel()
+		return s.complete(ctx, cfg, red.apply(build(cfg)))
+	})
+	red.audit(ctx, cfg)
+	return red.Restore(reply), cfg, err
+}
+
+// complete performs a non-streaming call and records its usage
+func (s *AIService) complete(ctx context.Context, cfg *model.MLModel, req ChatRequest) (reply string, err error) {
+	var usage Usage
+	started := time.Now()
+	defer func() { recordUsage(ctx, cfg, req, reply, usage, started, err) }()
+
+	provider := GetProvider(cfg.Provider)
+	reqHttp, err := provider.NewRequest(ctx, cfg, req)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(reqHttp)
+	if err != nil {
+		utils.GetLogger().Error("ai analyze provider error", zap.Error(err))
+		return "", err
 	}
+	defer resp.Body.Close()
 
-	sysPrompt := "你是资深的日志分析助手。根据提供的日志片段，结合用户问题，用中文给出要点式分析：1) 现象与范围，2) 可能原因，3) 进一步的验证建议，4) 缓解或修复步骤。"
-	userPrompt := strings.TrimSpace(prompt)
-	if userPrompt == "" {
-		userPrompt = "请基于下列日志片段定位可能的问题并给出建议。"
+	respBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &ProviderError{StatusCode: resp.StatusCode, Body: string(respBytes), RetryAfter: retryAfter(resp.Header)}
 	}
-	userContent := fmt.Sprintf("%s\n\n日志片段(截断):\n%s", userPrompt, buf.String())
+	reply, usage, err = provider.ParseResponse(respBytes)
+	return reply, err
+}
 
-	endpoint := strings.TrimRight(cfg.APIBase, "/") + "/chat/completions"
-	payload := map[string]interface{}{
-		"model":       cfg.Model,
-		"messages":    []map[string]string{{"role": "system", "content": sysPrompt}, {"role": "user", "content": userContent}},
-		"max_tokens":  chooseInt(cfg.MaxTokens, 512),
-		"temperature": chooseFloat(cfg.Temperature, 0.3),
-		"stream":      false,
+// chatStream is the streaming variant of chat. Text deltas are restored and
+// forwarded to onDelta; once one was sent a failure no longer falls back to
+// the next model.
+func (s *AIService) chatStream(ctx context.Context, build func(cfg *model.MLModel) ChatRequest, onDelta func(delta string) error) (string, *model.MLModel, error) {
+	red := redactorFor(ctx)
+	write, flush := red.restoreStream(onDelta)
+	reply, cfg, err := s.callModels(ctx, func(ctx context.Context, cfg *model.MLModel) (string, error) {
+		sent := false
+		reply, err := s.stream(ctx, cfg, red.apply(build(cfg)), func(delta string) error {
+			sent = true
+			return write(delta)
+		})
+		if err != nil && sent {
+			return reply, &haltError{err: err}
+		}
+		return reply, err
+	})
+	if ferr := flush(); err == nil {
+		err = ferr
 	}
-	body, _ := json.Marshal(payload)
+	red.audit(ctx, cfg)
+	return red.Restore(reply), cfg, err
+}
+
+// stream sends a streaming chat completion to one model and forwards every
+// text delta to onDelta until the provider ends the stream. Usage is recorded
+// also for interrupted streams.
+func (s *AIService) stream(ctx context.Context, cfg *model.MLModel, req ChatRequest, onDelta func(delta string) error) (text string, err error) {
+	var usage Usage
+	started := time.Now()
+	defer func() { recordUsage(ctx, cfg, req, text, usage, started, err) }()
+
+	// The model timeout only bounds the wait for the response headers, the
+	// stream itself lives as long as ctx
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := time.AfterFunc(modelTimeout(cfg), cancel)
 
-	reqHttp, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	provider := GetProvider(cfg.Provider)
+	req.Stream = true
+	reqHttp, err := provider.NewRequest(attemptCtx, cfg, req)
 	if err != nil {
+		timer.Stop()
 		return "", err
 	}
-	reqHttp.Header.Set("Content-Type", "application/json")
-	reqHttp.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	reqHttp.Header.Set("Accept", "text/event-stream")
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(reqHttp)
+	resp, err := http.DefaultClient.Do(reqHttp)
+	if !timer.Stop() && ctx.Err() == nil {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return "", fmt.Errorf("%s: no response within %s: %w", cfg.Name, modelTimeout(cfg), context.DeadlineExceeded)
+	}
 	if err != nil {
 		utils.GetLogger().Error("ai analyze provider error", zap.Error(err))
 		return "", err
 	}
 	defer resp.Body.Close()
-
-	respBytes, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("provider error: %s", string(respBytes))
+		respBytes, _ := io.ReadAll(resp.Body)
+		return "", &ProviderError{StatusCode: resp.StatusCode, Body: string(respBytes), RetryAfter: retryAfter(resp.Header)}
 	}
 
-	var obj struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+	var reply strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		delta, u, done := provider.ParseStreamLine(scanner.Text())
+		usage.add(u)
+		if delta != "" {
+			reply.WriteString(delta)
+			if err := onDelta(delta); err != nil {
+				return reply.String(), err
+			}
+		}
+		if done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return reply.String(), err
 	}
-	if err := json.Unmarshal(respBytes, &obj); err == nil && len(obj.Choices) > 0 {
-		return obj.Choices[0].Message.Content, nil
+	return reply.String(), nil
+}
+
+// TestModel sends a one token prompt to check connectivity and credentials
+// of an (unsaved) model config
+func (s *AIService) TestModel(ctx context.Context, cfg *model.MLModel) error {
+	if err := ValidateModelConfig(cfg); err != nil {
+		return err
 	}
-	return string(respBytes), nil
+	ctx, cancel := context.WithTimeout(WithUsageScope(ctx, UsageScope{Feature: FeatureTest}), 10*time.Second)
+	defer cancel()
+	_, err := s.complete(ctx, cfg, ChatRequest{Messages: []map[string]string{{"role": "user", "content": "ping"}}, MaxTokens: 1})
+	return err
 }
 
 func chooseInt(v int, def int) int {
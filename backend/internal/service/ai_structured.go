@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+	"ailap-backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// Severities of a StructuredAnalysis, most severe first
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+	SeverityMedium   = "medium"
+	SeverityLow      = "low"
+	SeverityInfo     = "info"
+)
+
+// Severities lists the severities from most to least severe
+var Severities = []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo}
+
+// severityAliases maps what models tend to answer onto the severities
+var severityAliases = map[string]string{
+	"critical": SeverityCritical, "fatal": SeverityCritical, "emergency": SeverityCritical, "p0": SeverityCritical, "严重": SeverityCritical, "致命": SeverityCritical,
+	"high": SeverityHigh, "error": SeverityHigh, "major": SeverityHigh, "p1": SeverityHigh, "高": SeverityHigh,
+	"medium": SeverityMedium, "moderate": SeverityMedium, "warning": SeverityMedium, "warn": SeverityMedium, "p2": SeverityMedium, "中": SeverityMedium,
+	"low": SeverityLow, "minor": SeverityLow, "p3": SeverityLow, "低": SeverityLow,
+	"info": SeverityInfo, "informational": SeverityInfo, "none": SeverityInfo, "normal": SeverityInfo, "信息": SeverityInfo,
+}
+
+// StructuredAnalysis is what the model fills in in structured mode
+type StructuredAnalysis struct {
+	Severity         string             `json:"severity"`
+	Summary          string             `json:"summary"`
+	AffectedServices []string           `json:"affectedServices"`
+	RootCause        string             `json:"rootCause"`
+	Evidence         []AnalysisEvidence `json:"evidence"`
+	Actions          []string           `json:"actions"`
+}
+
+// AnalysisEvidence cites a row of the analysed logs by its index. Message is
+// copied from that row so the citation can be checked.
+type AnalysisEvidence struct {
+	Line    int    `json:"line"`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// AnalysisRecord is a stored analysis with its parsed result, nil when the
+// reply could not be validated
+type AnalysisRecord struct {
+	model.AIAnalysis
+	Analysis  *StructuredAnalysis `json:"analysis"`
+	Citations []Citation          `json:"citations"` // knowledge base excerpts the model was given
+}
+
+// structuredSchemaPrompt is appended to the role's system prompt
+const structuredSchemaPrompt = `Reply with a single JSON object and nothing else, following this schema:
+{"severity": "critical|high|medium|low|info", "summary": "<one sentence>", "affectedServices": ["<service>"], "rootCause": "<suspected root cause>", "evidence": [{"line": <row number after # in the logs>, "reason": "<why this row matters>"}], "actions": ["<recommended action>"]}
+Write the text fields in the answer language. Cite at most 10 evidence rows.`
+
+// maxStructuredAttempts bounds the re-prompts for a malformed reply
+const maxStructuredAttempts = 2
+
+// maxEvidenceMessage caps the row message copied into an evidence entry
+const maxEvidenceMessage = 300
+
+// trailingCommaPattern finds commas before a closing bracket, a common JSON slip
+var trailingCommaPattern = regexp.MustCompile(`,\s*([}\]])`)
+
+// AnalyzeStructured asks the model chain for a StructuredAnalysis and stores
+// it. Malformed replies are repaired where possible, otherwise the model is
+// re-prompted with the validation error. When no valid reply comes back the
+// record is still stored with Valid false and the raw reply; only failed
+// model calls return an error.
+func (s *AIService) AnalyzeStructured(ctx context.Context, in AnalysisInput, userID, monitorID uint) (*AnalysisRecord, error) {
+	role, err := resolveRole(in.Role)
+	if err != nil {
+		return nil, err
+	}
+	// The schema replaces the role's output format
+	structured := *role
+	structured.OutputFormat = ""
+	prompt := strings.TrimSpace(in.Prompt)
+	if prompt == "" {
+		prompt = role.defaultPrompt()
+	}
+
+	feature := FeatureStructured
+	if monitorID != 0 {
+		feature = FeatureMonitor
+	}
+	ctx = WithUsageScope(ctx, UsageScope{UserID: userID, MonitorID: monitorID, Feature: feature})
+	ctx = WithRedactionSource(ctx, in.DatasourceID)
+	in = s.withKnowledge(in, prompt)
+	record := &AnalysisRecord{
+		AIAnalysis: model.AIAnalysis{UserID: userID, MonitorID: monitorID, Role: role.Name, LogCount: len(in.Logs), Citations: marshalCitations(in.knowledge)},
+		Citations:  in.knowledge,
+	}
+	var followUps []map[string]string
+	for attempt := 0; attempt < maxStructuredAttempts && record.Analysis == nil; attempt++ {
+		reply, cfg, err := s.chat(ctx, func(cfg *model.MLModel) ChatRequest {
+			messages := []map[string]string{
+				{"role": "system", "content": s.systemPrompt(cfg, &structured, in) + "\n\n" + structuredSchemaPrompt},
+				{"role": "user", "content": prompt},
+			}
+			return chatRequest(cfg, append(messages, followUps...), 0.2)
+		})
+		if err != nil {
+			return nil, err
+		}
+		record.ModelID, record.ModelName, record.Raw = cfg.ID, cfg.Name, reply
+		parsed, perr := ParseStructuredAnalysis(reply, in.Logs)
+		if perr != nil {
+			followUps = append(followUps,
+				map[string]string{"role": "assistant", "content": reply},
+				map[string]string{"role": "user", "content": "The reply was not valid: " + perr.Error() + ". Return only the corrected JSON object following the schema."},
+			)
+			continue
+		}
+		record.Analysis = parsed
+	}
+
+	if a := record.Analysis; a != nil {
+		b, _ := json.Marshal(a)
+		record.Result, record.Valid, record.Severity, record.Raw = string(b), true, a.Severity, ""
+	}
+	if err := database.GetDB().Create(&record.AIAnalysis).Error; err != nil {
+		utils.GetLogger().Error("store ai analysis failed", zap.Error(err))
+	}
+	return record, nil
+}
+
+// ParseStructuredAnalysis validates a model reply against the schema. It
+// tolerates code fences, prose around the object, trailing commas, snake_case
+// keys, severity synonyms and single strings where lists are expected.
+// Evidence rows outside logs are dropped, the others get the row message.
+func ParseStructuredAnalysis(reply string, logs []interface{}) (*StructuredAnalysis, error) {
+	reply = strings.TrimSpace(reply)
+	if m := codeFencePattern.FindStringSubmatch(reply); m != nil {
+		reply = strings.TrimSpace(m[1])
+	}
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in reply")
+	}
+	body := trailingCommaPattern.ReplaceAllString(reply[start:end+1], "$1")
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	fields := map[string]interface{}{}
+	for k, v := range raw {
+		fields[strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(k))] = v
+	}
+
+	out := &StructuredAnalysis{
+		Summary:          strings.TrimSpace(stringValue(fields["summary"])),
+		RootCause:        strings.TrimSpace(stringValue(fields["rootcause"])),
+		AffectedServices: stringList(fields["affectedservices"], ","),
+		Actions:          stringList(fields["actions"], "\n"),
+	}
+	sev := strings.ToLower(strings.TrimSpace(stringValue(fields["severity"])))
+	if sev == "" {
+		return nil, fmt.Errorf("severity is required")
+	}
+	if out.Severity = severityAliases[sev]; out.Severity == "" {
+		return nil, fmt.Errorf("severity must be one of %s, got %q", strings.Join(Severities, ", "), sev)
+	}
+	if out.RootCause == "" && out.Summary == "" {
+		return nil, fmt.Errorf("rootCause is required")
+	}
+
+	items, _ := fields["evidence"].([]interface{})
+	for _, it := range items {
+		ev := AnalysisEvidence{Line: -1}
+		switch v := it.(type) {
+		case map[string]interface{}:
+			ev.Line = lineNumber(v["line"])
+			if ev.Line < 0 {
+				ev.Line = lineNumber(v["row"])
+			}
+			ev.Reason = strings.TrimSpace(stringValue(v["reason"]))
+		default:
+			ev.Line = lineNumber(v)
+		}
+		if ev.Line < 0 || (logs != nil && ev.Line >= len(logs)) {
+			continue
+		}
+		if logs != nil {
+			ev.Message = evidenceMessage(logs[ev.Line])
+		}
+		out.Evidence = append(out.Evidence, ev)
+	}
+	if out.AffectedServices == nil {
+		out.AffectedServices = []string{}
+	}
+	if out.Actions == nil {
+		out.Actions = []string{}
+	}
+	if out.Evidence == nil {
+		out.Evidence = []AnalysisEvidence{}
+	}
+	return out, nil
+}
+
+// stringList accepts a list of strings or a single string split on sep
+func stringList(v interface{}, sep string) []string {
+	var parts []string
+	switch t := v.(type) {
+	case []interface{}:
+		for _, it := range t {
+			parts = append(parts, stringValue(it))
+		}
+	case string:
+		parts = strings.Split(t, sep)
+	}
+	var out []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// lineNumber reads a row reference such as 12, "12" or "#12"; -1 if invalid
+func lineNumber(v interface{}) int {
+	switch t := v.(type) {
+	case float64:
+		if t >= 0 && t == math.Trunc(t) {
+			return int(t)
+		}
+	case string:
+		if n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(t), "#")); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return -1
+}
+
+func evidenceMessage(row interface{}) string {
+	msg := fmt.Sprintf("%v", row)
+	if m, ok := row.(map[string]interface{}); ok {
+		msg = stringValue(m["message"])
+	}
+	if r := []rune(strings.TrimSpace(msg)); len(r) > maxEvidenceMessage {
+		return string(r[:maxEvidenceMessage]) + "…"
+	}
+	return strings.TrimSpace(msg)
+}
+
+// Text renders the analysis for notifications
+func (a *StructuredAnalysis) Text() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Severity: %s\n", strings.ToUpper(a.Severity))
+	if a.Summary != "" {
+		fmt.Fprintf(&sb, "Summary: %s\n", a.Summary)
+	}
+	if len(a.AffectedServices) > 0 {
+		fmt.Fprintf(&sb, "Affected services: %s\n", strings.Join(a.AffectedServices, ", "))
+	}
+	if a.RootCause != "" {
+		fmt.Fprintf(&sb, "Root cause: %s\n", a.RootCause)
+	}
+	if len(a.Evidence) > 0 {
+		sb.WriteString("Evidence:\n")
+		for _, ev := range a.Evidence {
+			fmt.Fprintf(&sb, "- #%d", ev.Line)
+			if ev.Reason != "" {
+				sb.WriteString(" " + ev.Reason)
+			}
+			if ev.Message != "" {
+				sb.WriteString(" | " + ev.Message)
+			}
+			sb.WriteByte('\n')
+		}
+	}
+	if len(a.Actions) > 0 {
+		sb.WriteString("Actions:\n")
+		for i, act := range a.Actions {
+			fmt.Fprintf(&sb, "%d. %s\n", i+1, act)
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// GetAnalysis loads a stored analysis
+func (s *AIService) GetAnalysis(id uint) (*AnalysisRecord, error) {
+	var rec model.AIAnalysis
+	if err := database.GetDB().First(&rec, id).Error; err != nil {
+		return nil, err
+	}
+	return newAnalysisRecord(rec), nil
+}
+
+// ListAnalyses returns the latest stored analyses, optionally of one monitor or severity
+func (s *AIService) ListAnalyses(monitorID uint, severity string, limit int) ([]*AnalysisRecord, error) {
+	q := database.GetDB().Order("id desc").Limit(chooseInt(limit, 50))
+	if monitorID != 0 {
+		q = q.Where("monitor_id = ?", monitorID)
+	}
+	if severity != "" {
+		q = q.Where("severity = ?", severity)
+	}
+	var items []model.AIAnalysis
+	if err := q.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	out := make([]*AnalysisRecord, 0, len(items))
+	for _, rec := range items {
+		out = append(out, newAnalysisRecord(rec))
+	}
+	return out, nil
+}
+
+// newAnalysisRecord decodes the stored result of a valid analysis
+func newAnalysisRecord(rec model.AIAnalysis) *AnalysisRecord {
+	out := &AnalysisRecord{AIAnalysis: rec}
+	if rec.Citations != "" {
+		_ = json.Unmarshal([]byte(rec.Citations), &out.Citations)
+	}
+	if rec.Valid {
+		var a StructuredAnalysis
+		if err := json.Unmarshal([]byte(rec.Result), &a); err == nil {
+			out.Analysis = &a
+		}
+	}
+	return out
+}
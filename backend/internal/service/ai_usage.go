@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+	"ailap-backend/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// Features a model call is attributed to, see UsageScope
+const (
+	FeatureConversation  = "conversation"
+	FeatureStructured    = "structured"
+	FeatureMonitor       = "monitor"
+	FeatureGenerateQuery = "generate-query"
+	FeatureTest          = "test"
+)
+
+// Statuses of an AIUsage record
+const (
+	UsageOK      = "ok"
+	UsageError   = "error"
+	UsageBlocked = "blocked"
+)
+
+// Budget scopes, periods and actions, see model.AIBudget
+const (
+	BudgetGlobal  = "global"
+	BudgetModel   = "model"
+	BudgetUser    = "user"
+	BudgetDay     = "day"
+	BudgetMonth   = "month"
+	BudgetBlock   = "block"
+	BudgetDegrade = "degrade"
+)
+
+// maxUsageError caps the error text stored with a failed call
+const maxUsageError = 500
+
+// UsageScope attributes the model calls made with a context
+type UsageScope struct {
+	UserID    uint
+	MonitorID uint
+	Feature   string
+}
+
+type usageScopeKey struct{}
+
+// WithUsageScope attributes the model calls made with ctx. Zero fields keep
+// the values of an outer scope, so handlers can set the user and services the feature.
+func WithUsageScope(ctx context.Context, scope UsageScope) context.Context {
+	outer := usageScopeOf(ctx)
+	if scope.UserID == 0 {
+		scope.UserID = outer.UserID
+	}
+	if scope.MonitorID == 0 {
+		scope.MonitorID = outer.MonitorID
+	}
+	if scope.Feature == "" {
+		scope.Feature = outer.Feature
+	}
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+func usageScopeOf(ctx context.Context) UsageScope {
+	scope, _ := ctx.Value(usageScopeKey{}).(UsageScope)
+	return scope
+}
+
+// callCost prices token counts with the model's per million token prices
+func callCost(cfg *model.MLModel, u Usage) float64 {
+	return (float64(u.PromptTokens)*cfg.PromptPrice + float64(u.CompletionTokens)*cfg.CompletionPrice) / 1e6
+}
+
+// recordUsage stores one model call. Token counts the provider didn't report
+// are estimated from the request and reply.
+func recordUsage(ctx context.Context, cfg *model.MLModel, req ChatRequest, reply string, u Usage, started time.Time, callErr error) {
+	scope := usageScopeOf(ctx)
+	rec := model.AIUsage{
+		UserID: scope.UserID, MonitorID: scope.MonitorID, Feature: scope.Feature,
+		ModelID: cfg.ID, ModelName: cfg.Name, Provider: cfg.Provider,
+		PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens,
+		LatencyMs: time.Since(started).Milliseconds(), Status: UsageOK,
+	}
+	if u == (Usage{}) && (callErr == nil || reply != "") {
+		for _, m := range req.Messages {
+			rec.PromptTokens += estimateTokens(m["content"])
+		}
+		rec.CompletionTokens = estimateTokens(reply)
+		rec.Estimated = true
+	}
+	rec.Cost = callCost(cfg, Usage{PromptTokens: rec.PromptTokens, CompletionTokens: rec.CompletionTokens})
+	if callErr != nil {
+		rec.Status, rec.Error = UsageError, truncateError(callErr)
+	}
+	if err := database.GetDB().Create(&rec).Error; err != nil {
+		utils.GetLogger().Error("record ai usage failed", zap.Error(err))
+	}
+}
+
+// recordBlocked stores a call refused by a budget
+func recordBlocked(ctx context.Context, cfg *model.MLModel, reason error) {
+	scope := usageScopeOf(ctx)
+	rec := model.AIUsage{
+		UserID: scope.UserID, MonitorID: scope.MonitorID, Feature: scope.Feature,
+		ModelID: cfg.ID, ModelName: cfg.Name, Provider: cfg.Provider,
+		Status: UsageBlocked, Error: truncateError(reason),
+	}
+	if err := database.GetDB().Create(&rec).Error; err != nil {
+		utils.GetLogger().Error("record ai usage failed", zap.Error(err))
+	}
+}
+
+func truncateError(err error) string {
+	msg := err.Error()
+	if len(msg) > maxUsageError {
+		msg = msg[:maxUsageError]
+	}
+	return msg
+}
+
+// ErrBudgetExceeded matches the errors of budgets refusing a call
+var ErrBudgetExceeded = errors.New("ai budget exceeded")
+
+// BudgetError is a budget refusing a call. Stop is set when no other model of
+// the chain may answer instead.
+type BudgetError struct {
+	Budget *model.AIBudget
+	Spent  float64
+	Stop   bool
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("ai budget exceeded: %s (%s %s, %.4f of %.4f)", e.Budget.Name, e.Budget.Scope, e.Budget.Period, e.Spent, e.Budget.MaxCost)
+}
+
+func (e *BudgetError) Is(target error) bool { return target == ErrBudgetExceeded }
+
+// periodStart returns the local start of the day or month containing now
+func periodStart(period string, now time.Time) time.Time {
+	y, m, d := now.Date()
+	if period == BudgetMonth {
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
+
+// budgetSpent sums the cost booked in the budget's scope and current period
+func budgetSpent(b *model.AIBudget, now time.Time) float64 {
+	q := database.GetDB().Model(&model.AIUsage{}).Where("created_at >= ?", periodStart(b.Period, now))
+	switch b.Scope {
+	case BudgetModel:
+		q = q.Where("model_id = ?", b.ScopeID)
+	case BudgetUser:
+		q = q.Where("user_id = ?", b.ScopeID)
+	}
+	var spent float64
+	q.Select("COALESCE(SUM(cost), 0)").Scan(&spent)
+	return spent
+}
+
+// checkBudget decides whether cfg may answer a call made with ctx. An
+// exhausted model budget skips the model so the chain falls back. Exhausted
+// user and global budgets refuse the call ("block") or admit only free
+// models ("degrade").
+func checkBudget(ctx context.Context, cfg *model.MLModel) error {
+	scope := usageScopeOf(ctx)
+	var budgets []model.AIBudget
+	err := database.GetDB().Where("enabled = ? AND max_cost > 0 AND (scope = ? OR (scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?))",
+		true, BudgetGlobal, BudgetModel, cfg.ID, BudgetUser, scope.UserID).Find(&budgets).Error
+	if err != nil || len(budgets) == 0 {
+		return nil
+	}
+	free := cfg.PromptPrice == 0 && cfg.CompletionPrice == 0
+	now := time.Now()
+	for i := range budgets {
+		b := &budgets[i]
+		if b.Scope == BudgetUser && scope.UserID == 0 {
+			continue
+		}
+		spent := budgetSpent(b, now)
+		if spent < b.MaxCost {
+			continue
+		}
+		switch {
+		case b.Scope == BudgetModel:
+			return &BudgetError{Budget: b, Spent: spent}
+		case b.Action == BudgetDegrade && free:
+			continue
+		case b.Action == BudgetDegrade:
+			return &BudgetError{Budget: b, Spent: spent}
+		default:
+			return &BudgetError{Budget: b, Spent: spent, Stop: true}
+		}
+	}
+	return nil
+}
+
+// ValidateBudget checks the enumerations and the cap of a budget
+func ValidateBudget(b *model.AIBudget) error {
+	switch {
+	case b.Scope != BudgetGlobal && b.Scope != BudgetModel && b.Scope != BudgetUser:
+		return fmt.Errorf("scope must be global, model or user")
+	case b.Scope != BudgetGlobal && b.ScopeID == 0:
+		return fmt.Errorf("scopeId is required for %s budgets", b.Scope)
+	case b.Period != BudgetDay && b.Period != BudgetMonth:
+		return fmt.Errorf("period must be day or month")
+	case b.Action != BudgetBlock && b.Action != BudgetDegrade:
+		return fmt.Errorf("action must be block or degrade")
+	case b.MaxCost <= 0:
+		return fmt.Errorf("maxCost must be positive")
+	}
+	return nil
+}
+
+// BudgetStatus is a budget with what was spent in its current period
+type BudgetStatus struct {
+	model.AIBudget
+	Spent    float64 `json:"spent"`
+	Exceeded bool    `json:"exceeded"`
+}
+
+// ListBudgets returns all budgets with their current spend
+func (s *AIService) ListBudgets() ([]BudgetStatus, error) {
+	var items []model.AIBudget
+	if err := database.GetDB().Order("id asc").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]BudgetStatus, 0, len(items))
+	for i := range items {
+		spent := budgetSpent(&items[i], now)
+		out = append(out, BudgetStatus{AIBudget: items[i], Spent: spent, Exceeded: items[i].MaxCost > 0 && spent >= items[i].MaxCost})
+	}
+	return out, nil
+}
+
+// usageGroups maps the groupBy values of UsageSummary to their column
+var usageGroups = map[string]string{
+	"model":   "model_id",
+	"user":    "user_id",
+	"monitor": "monitor_id",
+	"feature": "feature",
+	"day":     "substr(created_at, 1, 10)",
+}
+
+// UsageSummaryRow aggregates the usage records of one group
+type UsageSummaryRow struct {
+	Key              string  `gorm:"column:group_key" json:"key"`
+	Label            string  `json:"label"`
+	Calls            int64   `json:"calls"`
+	Errors           int64   `json:"errors"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatencyMs     float64 `json:"avgLatencyMs"`
+}
+
+// UsageSummary aggregates the usage records in [from, to) by model, user,
+// monitor, feature or day, most expensive first, and returns the totals
+func (s *AIService) UsageSummary(from, to time.Time, groupBy string) ([]UsageSummaryRow, *UsageSummaryRow, error) {
+	col, ok := usageGroups[groupBy]
+	if !ok {
+		return nil, nil, fmt.Errorf("groupBy must be model, user, monitor, feature or day")
+	}
+	rows := []UsageSummaryRow{}
+	err := database.GetDB().Model(&model.AIUsage{}).
+		Select("CAST("+col+" AS TEXT) AS group_key, MAX(model_name) AS label, COUNT(*) AS calls, "+
+			"SUM(CASE WHEN status <> ? THEN 1 ELSE 0 END) AS errors, SUM(prompt_tokens) AS prompt_tokens, "+
+			"SUM(completion_tokens) AS completion_tokens, SUM(cost) AS cost, AVG(latency_ms) AS avg_latency_ms", UsageOK).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group(col).Order("cost desc").Scan(&rows).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	total := &UsageSummaryRow{Key: "total", Label: "total"}
+	var latency float64
+	for i := range rows {
+		r := &rows[i]
+		total.Calls += r.Calls
+		total.Errors += r.Errors
+		total.PromptTokens += r.PromptTokens
+		total.CompletionTokens += r.CompletionTokens
+		total.Cost += r.Cost
+		latency += r.AvgLatencyMs * float64(r.Calls)
+		if groupBy != "model" {
+			r.Label = r.Key
+		}
+	}
+	if total.Calls > 0 {
+		total.AvgLatencyMs = latency / float64(total.Calls)
+	}
+	usageLabels(groupBy, rows)
+	return rows, total, nil
+}
+
+// usageLabels names user and monitor groups
+func usageLabels(groupBy string, rows []UsageSummaryRow) {
+	var names func(ids []uint) map[uint]string
+	switch groupBy {
+	case "user":
+		names = func(ids []uint) map[uint]string {
+			var users []model.User
+			database.GetDB().Where("id IN ?", ids).Find(&users)
+			out := map[uint]string{}
+			for _, u := range users {
+				out[u.ID] = u.Username
+			}
+			return out
+		}
+	case "monitor":
+		names = func(ids []uint) map[uint]string {
+			var monitors []model.LogMonitor
+			database.GetDB().Where("id IN ?", ids).Find(&monitors)
+			out := map[uint]string{}
+			for _, m := range monitors {
+				out[m.ID] = m.Name
+			}
+			return out
+		}
+	default:
+		return
+	}
+	ids := make([]uint, 0, len(rows))
+	for _, r := range rows {
+		if id, err := strconv.ParseUint(r.Key, 10, 64); err == nil && id > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	byID := names(ids)
+	for i := range rows {
+		id, _ := strconv.ParseUint(rows[i].Key, 10, 64)
+		if name, ok := byID[uint(id)]; ok {
+			rows[i].Label = name
+		} else if id == 0 {
+			rows[i].Label = "-"
+		}
+	}
+}
+
+// ListUsage returns the latest usage records, optionally of one user, model or monitor
+func (s *AIService) ListUsage(userID, modelID, monitorID uint, limit int) ([]model.AIUsage, error) {
+	q := database.GetDB().Order("id desc").Limit(chooseInt(limit, 100))
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	if modelID != 0 {
+		q = q.Where("model_id = ?", modelID)
+	}
+	if monitorID != 0 {
+		q = q.Where("monitor_id = ?", monitorID)
+	}
+	var items []model.AIUsage
+	err := q.Find(&items).Error
+	return items, err
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// LogCounter is implemented by engines that can count the entries matching a
+// query over its whole time range, optionally grouped by a label / field. It
+// backs the monitor rule conditions, which need exact counts rather than the
+// capped rows of a query.
+type LogCounter interface {
+	// Count returns the count per value of groupBy; with an empty groupBy the
+	// single total is returned under the "" key
+	Count(ctx context.Context, ds *Datasource, req QueryRequest, groupBy string) (map[string]float64, error)
+}
+
+// countFieldPattern restricts group-by names to plain field names so they can
+// be spliced into LogsQL and aggregation requests. Loki groups by stream
+// labels, whose names follow the stricter Prometheus label syntax of LogQL's
+// sum by.
+var (
+	countFieldPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-@]*$`)
+	lokiLabelPattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ValidateGroupBy checks that the engine can count per value of groupBy
+func ValidateGroupBy(engine, groupBy string) error {
+	pattern := countFieldPattern
+	if engine == "loki" {
+		pattern = lokiLabelPattern
+	}
+	if !pattern.MatchString(groupBy) {
+		return fmt.Errorf("invalid group by field %q for %s", groupBy, engine)
+	}
+	return nil
+}
+
+// Count counts the entries matching the query and time range per groupBy value
+func (s *LogService) Count(ctx context.Context, engine, datasourceID string, req QueryRequest, groupBy string) (map[string]float64, error) {
+	if groupBy != "" {
+		if err := ValidateGroupBy(engine, groupBy); err != nil {
+			return nil, err
+		}
+	}
+	e, ds, err := s.resolve(engine, datasourceID)
+	if err != nil {
+		return nil, err
+	}
+	if req, err = applyFilter(e, ds, req); err != nil {
+		return nil, err
+	}
+	counter, ok := e.(LogCounter)
+	if !ok {
+		return nil, fmt.Errorf("engine %s does not support counting", engine)
+	}
+	req.Start, req.End = defaultTimeRange(req.Start, req.End)
+	return counter.Count(ctx, ds, req, groupBy)
+}
+
+// countRange is the length of the request's time range in whole seconds, at least one
+func countRange(req QueryRequest) time.Duration {
+	startNs, _ := strconv.ParseInt(req.Start, 10, 64)
+	endNs, _ := strconv.ParseInt(req.End, 10, 64)
+	d := time.Duration(endNs - startNs).Truncate(time.Second)
+	if d < time.Second {
+		return time.Second
+	}
+	return d
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+)
+
+// LogEngine is a log backend driver (loki, elasticsearch, victorialogs, ...).
+// Drivers register themselves with RegisterEngine and are looked up by the
+// datasource type, so handlers and monitors never branch on engine names.
+type LogEngine interface {
+	// Name is the datasource type served by this engine, e.g. "loki"
+	Name() string
+	// Query runs a log query and returns flattened rows
+	Query(ctx context.Context, ds *Datasource, req QueryRequest) (*QueryResult, error)
+	// Labels lists label / field names available for autocompletion
+	Labels(ctx context.Context, ds *Datasource) ([]string, error)
+	// LabelValues lists values of a single label / field
+	LabelValues(ctx context.Context, ds *Datasource, label string) ([]string, error)
+	// Inspect describes the raw request Query would send
+	Inspect(ds *Datasource, req QueryRequest) (*InspectResult, error)
+	// TestConnection probes the backend with the datasource settings
+	TestConnection(ctx context.Context, ds *Datasource) (*ConnectionResult, error)
+}
+
+// LogTailer is implemented by engines that can stream new entries live.
+// emit receives rows in the same shape Query returns.
+type LogTailer interface {
+	Tail(ctx context.Context, ds *Datasource, req QueryRequest, emit func(rows []map[string]interface{}) error) error
+}
+
+// Datasource bundles a stored datasource with its decoded config and endpoint
+type Datasource struct {
+	Model    model.DataSource
+	Config   map[string]interface{}
+	Endpoint string
+}
+
+// QueryRequest is an engine independent log query
+type QueryRequest struct {
+	Query     string
+	Start     string // unix ns, optional
+	End       string // unix ns, optional
+	Limit     int
+	Step      string
+	Direction string
+	Cursor    string // opaque continuation cursor from a previous QueryResult
+	// Paginate is set by callers that page with NextCursor; engines may keep
+	// server side state for it, such as an elasticsearch point in time
+	Paginate bool
+	// Filter is an optional engine neutral filter ANDed with Query
+	Filter *Filter
+}
+
+// queryCursor is the decoded form of the opaque pagination cursor. Each engine
+// only fills the fields it needs to continue after the last returned row.
+type queryCursor struct {
+	Engine     string        `json:"e"`
+	Timestamp  string        `json:"t,omitempty"` // loki: ns of the last row, victorialogs: oldest row, the inclusive next window end
+	Direction  string        `json:"d,omitempty"` // loki: BACKWARD or FORWARD
+	SortValues []interface{} `json:"s,omitempty"` // elasticsearch: search_after values
+	PIT        string        `json:"p,omitempty"` // elasticsearch: point in time id, "" without one
+	Seen       []string      `json:"k,omitempty"` // loki, victorialogs: keys of the rows already returned at Timestamp
+}
+
+// pageRowKey identifies a row by all its fields, telling apart the rows that
+// share the edge timestamp of a page (see queryCursor.Seen)
+func pageRowKey(row map[string]interface{}) string {
+	keys := make([]string, 0, len(row))
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := fnv.New64a()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%v\n", k, row[k])
+	}
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+func encodeCursor(c queryCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a cursor and checks it was issued by the same engine
+func decodeCursor(engine, raw string) (*queryCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c queryCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Engine != engine {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &c, nil
+}
+
+// InspectResult is the raw request an engine would send for a query
+type InspectResult struct {
+	URL  string `json:"url"`
+	Body string `json:"body,omitempty"`
+}
+
+// ConnectionResult is the outcome of a datasource connection test
+type ConnectionResult struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+	Status     string `json:"status"`
+	Body       string `json:"body"`
+}
+
+// OK reports whether the backend answered with a 2xx status
+func (r *ConnectionResult) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+var (
+	enginesMu sync.RWMutex
+	engines   = map[string]LogEngine{}
+)
+
+// RegisterEngine makes a log engine available under its Name. Registering the
+// same name twice replaces the previous driver.
+func RegisterEngine(e LogEngine) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	engines[e.Name()] = e
+}
+
+// GetEngine returns the engine registered for the given datasource type
+func GetEngine(name string) (LogEngine, bool) {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	e, ok := engines[name]
+	return e, ok
+}
+
+// EngineNames lists registered engines in alphabetical order
+func EngineNames() []string {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveDatasource loads the datasource by id, falling back to the first
+// datasource of the given engine type when id is empty or unknown.
+func ResolveDatasource(engine, id string) (*Datasource, bool) {
+	var ds model.DataSource
+	found := false
+	if id != "" {
+		found = database.GetDB().First(&ds, "id = ?", id).Error == nil
+	}
+	if !found {
+		var items []model.DataSource
+		database.GetDB().Where("type = ?", engine).Find(&items)
+		if len(items) == 0 {
+			return nil, false
+		}
+		ds = items[0]
+	}
+	var cfg map[string]interface{}
+	_ = json.Unmarshal([]byte(ds.Config), &cfg)
+	endpoint := ds.Endpoint
+	if endpoint == "" && cfg != nil {
+		if v, ok := cfg["endpoint"].(string); ok {
+			endpoint = v
+		}
+	}
+	return &Datasource{Model: ds, Config: cfg, Endpoint: endpoint}, true
+}
+
+// hasPath reports whether the provided endpoint already contains a non-root path
+func hasPath(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return u.Path != "" && u.Path != "/"
+}
+
+// buildEngineURL appends the engine API path to a bare endpoint. Endpoints
+// that already carry a path are treated as full API URLs.
+func buildEngineURL(endpoint, apiPath string, params url.Values) string {
+	encoded := ""
+	if len(params) > 0 {
+		encoded = "?" + params.Encode()
+	}
+	if !hasPath(endpoint) {
+		return endpoint + apiPath + encoded
+	}
+	if strings.Contains(endpoint, "?") {
+		return endpoint
+	}
+	return endpoint + encoded
+}
+
+// doEngineRequest sends an authenticated request to the datasource and
+// returns the body, failing on non-2xx responses.
+func doEngineRequest(ds *Datasource, req *http.Request, timeout time.Duration) ([]byte, error) {
+	ApplyAuthHeaders(req, ds.Config)
+	client := CreateHTTPClient(ds.Config, timeout)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s error: %s", ds.Model.Type, string(body))
+	}
+	return body, nil
+}
+
+// engineGet is doEngineRequest for plain GET requests
+func engineGet(ctx context.Context, ds *Datasource, reqURL string, timeout time.Duration) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doEngineRequest(ds, req, timeout)
+}
+
+// probeEndpoint performs a connection test GET using the datasource TLS and
+// credential settings as entered in the datasource form.
+func probeEndpoint(ctx context.Context, ds *Datasource, reqURL string) (*ConnectionResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	cfg := ds.Config
+	if token := configString(cfg, "token"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if apiKey := configString(cfg, "apiKey"); apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+	}
+	if username := configString(cfg, "username"); username != "" {
+		if password := configString(cfg, "password"); password != "" {
+			req.SetBasicAuth(username, password)
+		}
+	}
+	resp, err := createTestHTTPClient(cfg, 5*time.Second).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return &ConnectionResult{URL: reqURL, StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}, nil
+}
+
+// createTestHTTPClient creates an HTTP client with TLS configuration for testing
+func createTestHTTPClient(cfg map[string]interface{}, timeout time.Duration) *http.Client {
+	transport := &http.Transport{}
+
+	// TLS configuration
+	if tlsCfg := getTestTLSConfig(cfg); tlsCfg != nil {
+		transport.TLSClientConfig = tlsCfg
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+// getTestTLSConfig extracts TLS configuration from datasource config for testing
+func getTestTLSConfig(cfg map[string]interface{}) *tls.Config {
+	if cfg == nil {
+		return nil
+	}
+
+	tlsData, ok := cfg["tls"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	// Skip certificate verification
+	if skipVerify, ok := tlsData["skipVerify"].(bool); ok && skipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	// Server name for TLS
+	if serverName, ok := tlsData["serverName"].(string); ok && serverName != "" {
+		tlsConfig.ServerName = serverName
+	}
+
+	// CA certificate for self-signed certificates
+	if caCert, ok := tlsData["caCert"].(string); ok && caCert != "" {
+		caCertPool := x509.NewCertPool()
+		if caCertPool.AppendCertsFromPEM([]byte(caCert)) {
+			tlsConfig.RootCAs = caCertPool
+		}
+	}
+
+	// Client certificate authentication
+	if clientCert, ok := tlsData["clientCert"].(string); ok && clientCert != "" {
+		if clientKey, ok := tlsData["clientKey"].(string); ok && clientKey != "" {
+			cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
+			if err == nil {
+				tlsConfig.Certificates = []tls.Certificate{cert}
+			}
+		}
+	}
+
+	return tlsConfig
+}
+
+// configString reads a string value from a decoded JSON config map
+func configString(m map[string]interface{}, key string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// configSection returns a nested config object such as cfg["es"]
+func configSection(m map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := m[key].(map[string]interface{}); ok {
+		return v
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,610 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterEngine(&elasticsearchEngine{})
+}
+
+type elasticsearchEngine struct{}
+
+func (e *elasticsearchEngine) Name() string { return "elasticsearch" }
+
+// esSettings holds the index and field options of an elasticsearch datasource
+type esSettings struct {
+	indexPath    string
+	timeField    string
+	messageField string
+	levelField   string
+	xpack        bool
+	// filterLevel is the field Filter level conditions match against
+	filterLevel string
+}
+
+func (e *elasticsearchEngine) settings(ds *Datasource) esSettings {
+	st := esSettings{timeField: "@timestamp", messageField: "_source"}
+	es := configSection(ds.Config, "es")
+	if v := configString(es, "timeField"); v != "" {
+		st.timeField = v
+	}
+	if v := configString(es, "index"); v != "" {
+		st.indexPath = "/" + v
+	}
+	if v, ok := es["xpack"].(bool); ok {
+		st.xpack = v
+	}
+	logsCfg := configSection(ds.Config, "logs")
+	if v := configString(logsCfg, "messageField"); v != "" {
+		st.messageField = v
+	}
+	if v := configString(logsCfg, "levelField"); v != "" {
+		st.levelField = v
+	}
+	st.filterLevel = st.levelField
+	if st.filterLevel == "" {
+		st.filterLevel = filterLevelField(ds)
+	}
+	return st
+}
+
+// searchBody builds the _search request body for a query string, optional
+// filter and time range
+func (e *elasticsearchEngine) searchBody(st esSettings, req QueryRequest) map[string]interface{} {
+	nowMs := time.Now().UnixMilli()
+	startMs := nsToMs(req.Start, nowMs-3600*1000)
+	endMs := nsToMs(req.End, nowMs)
+
+	query := req.Query
+	if query == "" {
+		query = "*"
+	}
+
+	mustConditions := []interface{}{}
+	if query == "*" {
+		mustConditions = append(mustConditions, map[string]interface{}{"match_all": map[string]interface{}{}})
+	} else {
+		mustConditions = append(mustConditions, map[string]interface{}{"query_string": map[string]interface{}{"query": query}})
+	}
+	if req.Filter != nil {
+		// Validated by CompileFilter before the request reaches the engine
+		if clause, err := CompileElasticsearchDSL(req.Filter, st.filterLevel, st.messageField); err == nil {
+			mustConditions = append(mustConditions, clause)
+		}
+	}
+	mustConditions = append(mustConditions, map[string]interface{}{"range": map[string]interface{}{st.timeField: map[string]interface{}{"gte": startMs, "lte": endMs, "format": "epoch_millis"}}})
+
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": mustConditions,
+			},
+		},
+	}
+}
+
+func (e *elasticsearchEngine) search(ctx context.Context, ds *Datasource, st esSettings, bodyJSON map[string]interface{}, timeout time.Duration) ([]byte, error) {
+	payload, _ := json.Marshal(bodyJSON)
+	return e.request(ctx, ds, st, http.MethodPost, "/_search", strings.NewReader(string(payload)), timeout)
+}
+
+// request calls an index scoped API such as _search or _mapping
+func (e *elasticsearchEngine) request(ctx context.Context, ds *Datasource, st esSettings, method, apiPath string, body io.Reader, timeout time.Duration) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, ds.Endpoint+st.indexPath+apiPath, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if st.xpack {
+		req.Header.Set("X-Elastic-Product", "Elasticsearch")
+	}
+	return doEngineRequest(ds, req, timeout)
+}
+
+// esPITKeepAlive is how long a point in time stays open between two pages
+const esPITKeepAlive = "5m"
+
+// Query returns the newest documents first. Paginated queries search a point
+// in time sorted by time and _shard_doc, so documents sharing a timestamp at a
+// page boundary are neither skipped nor repeated. Other queries, and clusters
+// that cannot open a point in time (before 7.10, or without the privilege),
+// use _doc as tiebreaker, which is unique within a shard only.
+func (e *elasticsearchEngine) Query(ctx context.Context, ds *Datasource, req QueryRequest) (*QueryResult, error) {
+	st := e.settings(ds)
+	bodyJSON := e.searchBody(st, req)
+	bodyJSON["size"] = req.Limit
+	pit := ""
+	if req.Cursor != "" {
+		cur, err := decodeCursor(e.Name(), req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		bodyJSON["search_after"] = cur.SortValues
+		pit = cur.PIT
+	} else if req.Paginate && req.Limit > 0 {
+		pit = e.openPIT(ctx, ds, st)
+	}
+	bodyJSON["sort"] = esSort(st, "desc", pit != "")
+
+	var body []byte
+	var err error
+	if pit != "" {
+		bodyJSON["pit"] = map[string]interface{}{"id": pit, "keep_alive": esPITKeepAlive}
+		payload, _ := json.Marshal(bodyJSON)
+		// A point in time already names the indices, the path must not
+		noIndex := st
+		noIndex.indexPath = ""
+		body, err = e.request(ctx, ds, noIndex, http.MethodPost, "/_search", strings.NewReader(string(payload)), 60*time.Second)
+	} else {
+		body, err = e.search(ctx, ds, st, bodyJSON, 60*time.Second)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pit != "" {
+		// The id may change between searches, the latest one is kept
+		var resp struct {
+			PITID string `json:"pit_id"`
+		}
+		if json.Unmarshal(body, &resp) == nil && resp.PITID != "" {
+			pit = resp.PITID
+		}
+	}
+	items := FlattenElasticsearchToRows(body, st.timeField, st.messageField, st.levelField)
+	result := &QueryResult{Items: items}
+	if req.Limit > 0 && len(items) >= req.Limit {
+		if last := lastSortValues(body); last != nil {
+			result.NextCursor = encodeCursor(queryCursor{Engine: e.Name(), SortValues: last, PIT: pit})
+		}
+	}
+	if result.NextCursor == "" && pit != "" {
+		e.closePIT(ds, st, pit)
+	}
+	return result, nil
+}
+
+// esSort sorts by the time field with a tiebreaker: _shard_doc when searching
+// a point in time, _doc otherwise
+func esSort(st esSettings, order string, pit bool) []interface{} {
+	tiebreaker := "_doc"
+	if pit {
+		tiebreaker = "_shard_doc"
+	}
+	return []interface{}{
+		map[string]interface{}{st.timeField: map[string]interface{}{"order": order}},
+		map[string]interface{}{tiebreaker: map[string]interface{}{"order": order}},
+	}
+}
+
+// openPIT opens a point in time on the index, "" when the cluster refuses
+func (e *elasticsearchEngine) openPIT(ctx context.Context, ds *Datasource, st esSettings) string {
+	body, err := e.request(ctx, ds, st, http.MethodPost, "/_pit?keep_alive="+esPITKeepAlive, nil, 10*time.Second)
+	if err != nil {
+		return ""
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	return resp.ID
+}
+
+// closePIT releases a point in time once its last page was read. Failures are
+// ignored, the point in time expires after esPITKeepAlive anyway.
+func (e *elasticsearchEngine) closePIT(ds *Datasource, st esSettings, pit string) {
+	payload, _ := json.Marshal(map[string]interface{}{"id": pit})
+	noIndex := st
+	noIndex.indexPath = ""
+	_, _ = e.request(context.Background(), ds, noIndex, http.MethodDelete, "/_pit", strings.NewReader(string(payload)), 10*time.Second)
+}
+
+// Volume runs a date_histogram, split by the configured level field when set
+func (e *elasticsearchEngine) Volume(ctx context.Context, ds *Datasource, req QueryRequest, step time.Duration) (*VolumeResult, error) {
+	st := e.settings(ds)
+	histogram := map[string]interface{}{
+		"date_histogram": map[string]interface{}{
+			"field":          st.timeField,
+			"fixed_interval": formatStep(step),
+			"min_doc_count":  1,
+		},
+	}
+	if st.levelField != "" {
+		histogram["aggs"] = map[string]interface{}{
+			"levels": map[string]interface{}{
+				"terms": map[string]interface{}{"field": st.levelField, "size": 10, "missing": "unknown"},
+			},
+		}
+	}
+	bodyJSON := e.searchBody(st, req)
+	bodyJSON["size"] = 0
+	bodyJSON["aggs"] = map[string]interface{}{"volume": histogram}
+
+	body, err := e.search(ctx, ds, st, bodyJSON, 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Aggregations struct {
+			Volume struct {
+				Buckets []struct {
+					Key      int64 `json:"key"`
+					DocCount int64 `json:"doc_count"`
+					Levels   *struct {
+						Buckets []struct {
+							Key      interface{} `json:"key"`
+							DocCount int64       `json:"doc_count"`
+						} `json:"buckets"`
+					} `json:"levels"`
+				} `json:"buckets"`
+			} `json:"volume"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	vc := newVolumeCollector()
+	for _, b := range resp.Aggregations.Volume.Buckets {
+		if b.Levels == nil {
+			vc.add("", b.Key, float64(b.DocCount))
+			continue
+		}
+		for _, lb := range b.Levels.Buckets {
+			vc.add(fmt.Sprintf("%v", lb.Key), b.Key, float64(lb.DocCount))
+		}
+	}
+	return vc.result(step), nil
+}
+
+// esCountGroups caps the number of buckets of a grouped count
+const esCountGroups = 500
+
+// Count reads the exact hit total, or a terms aggregation when grouped. Like
+// LabelValues, text fields fall back to their .keyword sub-field.
+func (e *elasticsearchEngine) Count(ctx context.Context, ds *Datasource, req QueryRequest, groupBy string) (map[string]float64, error) {
+	st := e.settings(ds)
+	counts, err := e.count(ctx, ds, st, req, groupBy)
+	if err != nil && groupBy != "" && !strings.HasSuffix(groupBy, ".keyword") {
+		counts, err = e.count(ctx, ds, st, req, groupBy+".keyword")
+	}
+	return counts, err
+}
+
+func (e *elasticsearchEngine) count(ctx context.Context, ds *Datasource, st esSettings, req QueryRequest, groupBy string) (map[string]float64, error) {
+	bodyJSON := e.searchBody(st, req)
+	bodyJSON["size"] = 0
+	bodyJSON["track_total_hits"] = true
+	if groupBy != "" {
+		bodyJSON["aggs"] = map[string]interface{}{
+			"groups": map[string]interface{}{
+				"terms": map[string]interface{}{"field": groupBy, "size": esCountGroups},
+			},
+		}
+	}
+
+	body, err := e.search(ctx, ds, st, bodyJSON, 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			Groups struct {
+				Buckets []struct {
+					Key      interface{} `json:"key"`
+					DocCount int64       `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"groups"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if groupBy == "" {
+		return map[string]float64{"": float64(resp.Hits.Total.Value)}, nil
+	}
+	counts := map[string]float64{}
+	for _, b := range resp.Aggregations.Groups.Buckets {
+		counts[fmt.Sprintf("%v", b.Key)] += float64(b.DocCount)
+	}
+	return counts, nil
+}
+
+// esTailInterval is how often Tail polls for documents newer than the cursor
+const esTailInterval = 2 * time.Second
+
+// Tail polls _search in ascending time order. Each poll searches again from
+// the newest timestamp already emitted, inclusive, and skips the documents
+// emitted with that timestamp, so documents indexed late with the same
+// timestamp are still emitted. Documents indexed with an older timestamp
+// than the cursor are not.
+func (e *elasticsearchEngine) Tail(ctx context.Context, ds *Datasource, req QueryRequest, emit func(rows []map[string]interface{}) error) error {
+	st := e.settings(ds)
+	start := req.Start
+	if start == "" {
+		start = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	size := req.Limit
+	if size <= 0 {
+		size = 500
+	}
+	// cursor is the newest timestamp emitted, in ms, and seen the ids of the
+	// documents emitted with it
+	var cursor int64 = -1
+	seen := map[string]bool{}
+	ticker := time.NewTicker(esTailInterval)
+	defer ticker.Stop()
+	for {
+		if cursor >= 0 {
+			start = strconv.FormatInt(cursor*1e6, 10)
+		}
+		bodyJSON := e.searchBody(st, QueryRequest{Query: req.Query, Filter: req.Filter, Start: start})
+		bodyJSON["sort"] = esSort(st, "asc", false)
+		// Room for the documents at the cursor that are skipped again
+		bodyJSON["size"] = size + len(seen)
+		body, err := e.search(ctx, ds, st, bodyJSON, 30*time.Second)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		rows := FlattenElasticsearchToRows(body, st.timeField, st.messageField, st.levelField)
+		hits := esHitKeys(body)
+		var fresh []map[string]interface{}
+		for i, h := range hits {
+			if i >= len(rows) || (h.ms == cursor && seen[h.id]) {
+				continue
+			}
+			if h.ms > cursor {
+				cursor, seen = h.ms, map[string]bool{}
+			}
+			seen[h.id] = true
+			fresh = append(fresh, rows[i])
+		}
+		if len(fresh) > 0 {
+			if err := emit(fresh); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Labels lists the field names of the index mapping, including multi-fields
+// such as "message.keyword"
+func (e *elasticsearchEngine) Labels(ctx context.Context, ds *Datasource) ([]string, error) {
+	body, err := e.request(ctx, ds, e.settings(ds), http.MethodGet, "/_mapping", nil, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var resp map[string]struct {
+		Mappings json.RawMessage `json:"mappings"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, index := range resp {
+		var mapping esMapping
+		if err := json.Unmarshal(index.Mappings, &mapping); err != nil {
+			continue
+		}
+		// Pre-7.x mappings are keyed by document type
+		if len(mapping.Properties) == 0 {
+			var typed map[string]esMapping
+			if json.Unmarshal(index.Mappings, &typed) == nil {
+				for _, m := range typed {
+					collectESFields("", m.Properties, seen)
+				}
+			}
+			continue
+		}
+		collectESFields("", mapping.Properties, seen)
+	}
+	fields := make([]string, 0, len(seen))
+	for f := range seen {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// esMapping is the subset of a mapping needed to list fields
+type esMapping struct {
+	Type       string               `json:"type"`
+	Properties map[string]esMapping `json:"properties"`
+	Fields     map[string]esMapping `json:"fields"`
+}
+
+// collectESFields walks nested properties into dotted field names
+func collectESFields(prefix string, props map[string]esMapping, seen map[string]bool) {
+	for name, m := range props {
+		field := prefix + name
+		if len(m.Properties) > 0 {
+			collectESFields(field+".", m.Properties, seen)
+			continue
+		}
+		seen[field] = true
+		for sub := range m.Fields {
+			seen[field+"."+sub] = true
+		}
+	}
+}
+
+// esValuesSize is the number of top values returned by LabelValues
+const esValuesSize = 50
+
+// LabelValues returns the most frequent values of a field over the last hour
+// using a terms aggregation. Text fields fall back to their .keyword sub-field.
+func (e *elasticsearchEngine) LabelValues(ctx context.Context, ds *Datasource, label string) ([]string, error) {
+	st := e.settings(ds)
+	values, err := e.topValues(ctx, ds, st, label)
+	if err != nil && !strings.HasSuffix(label, ".keyword") {
+		values, err = e.topValues(ctx, ds, st, label+".keyword")
+	}
+	return values, err
+}
+
+func (e *elasticsearchEngine) topValues(ctx context.Context, ds *Datasource, st esSettings, field string) ([]string, error) {
+	bodyJSON := e.searchBody(st, QueryRequest{})
+	bodyJSON["size"] = 0
+	bodyJSON["aggs"] = map[string]interface{}{
+		"values": map[string]interface{}{"terms": map[string]interface{}{"field": field, "size": esValuesSize}},
+	}
+	body, err := e.search(ctx, ds, st, bodyJSON, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Aggregations struct {
+			Values struct {
+				Buckets []struct {
+					Key interface{} `json:"key"`
+				} `json:"buckets"`
+			} `json:"values"`
+		} `json:"aggregations"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(resp.Aggregations.Values.Buckets))
+	for _, b := range resp.Aggregations.Values.Buckets {
+		values = append(values, fmt.Sprintf("%v", b.Key))
+	}
+	return values, nil
+}
+
+// CompileFilter validates the filter; searchBody turns it into query DSL
+func (e *elasticsearchEngine) CompileFilter(ds *Datasource, req QueryRequest) (QueryRequest, error) {
+	st := e.settings(ds)
+	if _, err := CompileElasticsearchDSL(req.Filter, st.filterLevel, st.messageField); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+func (e *elasticsearchEngine) Inspect(ds *Datasource, req QueryRequest) (*InspectResult, error) {
+	st := e.settings(ds)
+	b, _ := json.MarshalIndent(e.searchBody(st, req), "", "  ")
+	return &InspectResult{URL: ds.Endpoint + st.indexPath + "/_search", Body: string(b)}, nil
+}
+
+func (e *elasticsearchEngine) TestConnection(ctx context.Context, ds *Datasource) (*ConnectionResult, error) {
+	reqURL := ds.Endpoint
+	if !hasPath(reqURL) {
+		reqURL = reqURL + "/_cluster/health"
+	}
+	return probeEndpoint(ctx, ds, reqURL)
+}
+
+// nsToMs converts a unix ns string to epoch millis, returning def when empty or invalid
+func nsToMs(s string, def int64) int64 {
+	if s == "" {
+		return def
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v / 1e6
+	}
+	return def
+}
+
+// esHitKey identifies a hit of an ascending time sort
+type esHitKey struct {
+	id string
+	ms int64 // first sort value, the time in ms
+}
+
+// esHitKeys returns the id and time of every hit, in order
+func esHitKeys(body []byte) []esHitKey {
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				ID   string        `json:"_id"`
+				Sort []interface{} `json:"sort"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	keys := make([]esHitKey, len(resp.Hits.Hits))
+	for i, h := range resp.Hits.Hits {
+		keys[i].id = h.ID
+		if len(h.Sort) > 0 {
+			if v, ok := h.Sort[0].(float64); ok {
+				keys[i].ms = int64(v)
+			}
+		}
+	}
+	return keys
+}
+
+// lastSortValues returns the sort values of the last hit, used as search_after cursor
+func lastSortValues(body []byte) []interface{} {
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Sort []interface{} `json:"sort"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	if n := len(resp.Hits.Hits); n > 0 {
+		return resp.Hits.Hits[n-1].Sort
+	}
+	return nil
+}
+
+// FlattenElasticsearchToRows converts _search hits into table rows
+func FlattenElasticsearchToRows(body []byte, timeField, msgField, lvlField string) []map[string]interface{} {
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Source map[string]interface{} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	items := make([]map[string]interface{}, 0)
+	for _, hit := range resp.Hits.Hits {
+		src := hit.Source
+		row := make(map[string]interface{})
+		row["__raw"] = src
+
+		if t, ok := src[timeField]; ok {
+			row["timestamp"] = fmt.Sprintf("%v", t)
+		}
+		if msgField == "_source" {
+			b, _ := json.Marshal(src)
+			row["message"] = string(b)
+		} else {
+			if m, ok := src[msgField]; ok {
+				row["message"] = fmt.Sprintf("%v", m)
+			}
+		}
+		if lvlField != "" {
+			if l, ok := src[lvlField]; ok {
+				row["level"] = fmt.Sprintf("%v", l)
+			}
+		}
+		items = append(items, row)
+	}
+	return items
+}
@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func init() {
+	RegisterEngine(&lokiEngine{})
+}
+
+type lokiEngine struct{}
+
+func (e *lokiEngine) Name() string { return "loki" }
+
+func (e *lokiEngine) Query(ctx context.Context, ds *Datasource, req QueryRequest) (*QueryResult, error) {
+	direction := strings.ToUpper(req.Direction)
+	if direction != "FORWARD" {
+		direction = "BACKWARD" // default for monitoring usually latest
+	}
+	start, end := req.Start, req.End
+	limit := req.Limit
+	var cur *queryCursor
+	seen := map[string]bool{}
+	if req.Cursor != "" {
+		var err error
+		if cur, err = decodeCursor(e.Name(), req.Cursor); err != nil {
+			return nil, err
+		}
+		direction = cur.Direction
+		// Loki treats start as inclusive and end as exclusive. The edge
+		// timestamp is queried again since other streams may hold rows at
+		// the same nanosecond; the rows already returned there are dropped.
+		if direction == "FORWARD" {
+			start = cur.Timestamp
+		} else {
+			ts, _ := strconv.ParseInt(cur.Timestamp, 10, 64)
+			end = strconv.FormatInt(ts+1, 10)
+		}
+		for _, k := range cur.Seen {
+			seen[k] = true
+		}
+		if limit > 0 {
+			limit += len(seen)
+		}
+	}
+
+	params := url.Values{}
+	params.Set("query", req.Query)
+	params.Set("start", start)
+	params.Set("end", end)
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("direction", direction)
+	if req.Step != "" {
+		params.Set("step", req.Step)
+	}
+
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, "/loki/api/v1/query_range", params), 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	// Metric queries (count_over_time, rate, sum by ...) return a matrix
+	if series, ok := FlattenLokiMatrix(body); ok {
+		return &QueryResult{Items: []map[string]interface{}{}, ResultType: "matrix", Series: series}, nil
+	}
+	rows := FlattenLokiToRows(body)
+	result := &QueryResult{Items: make([]map[string]interface{}, 0, len(rows))}
+	for _, row := range rows {
+		if cur != nil && row["timestamp"] == cur.Timestamp && seen[pageRowKey(row)] {
+			continue
+		}
+		result.Items = append(result.Items, row)
+	}
+	if req.Limit > 0 && len(rows) >= limit {
+		if ts, ok := lokiEdgeTimestamp(result.Items, direction); ok {
+			next := queryCursor{Engine: e.Name(), Timestamp: ts, Direction: direction}
+			if cur != nil && cur.Timestamp == ts {
+				next.Seen = append(next.Seen, cur.Seen...)
+			}
+			for _, row := range result.Items {
+				if row["timestamp"] == ts {
+					next.Seen = append(next.Seen, pageRowKey(row))
+				}
+			}
+			result.NextCursor = encodeCursor(next)
+		}
+	}
+	return result, nil
+}
+
+// lokiEdgeTimestamp returns the oldest (BACKWARD) or newest (FORWARD) row
+// timestamp. Rows are grouped per stream, so every row has to be checked.
+func lokiEdgeTimestamp(rows []map[string]interface{}, direction string) (string, bool) {
+	var edge int64
+	found := false
+	for _, row := range rows {
+		s, _ := row["timestamp"].(string)
+		ts, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			continue
+		}
+		if !found || (direction == "FORWARD" && ts > edge) || (direction != "FORWARD" && ts < edge) {
+			edge = ts
+			found = true
+		}
+	}
+	return strconv.FormatInt(edge, 10), found
+}
+
+// Volume counts matching lines per level with a count_over_time metric query
+func (e *lokiEngine) Volume(ctx context.Context, ds *Datasource, req QueryRequest, step time.Duration) (*VolumeResult, error) {
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf("sum by (level) (count_over_time(%s [%s]))", req.Query, formatStep(step)))
+	params.Set("start", req.Start)
+	params.Set("end", req.End)
+	params.Set("step", formatStep(step))
+
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, "/loki/api/v1/query_range", params), 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	series, _ := FlattenLokiMatrix(body)
+	vc := newVolumeCollector()
+	for _, s := range series {
+		for _, p := range s.Points {
+			vc.add(s.Labels["level"], p.Timestamp, p.Value)
+		}
+	}
+	return vc.result(step), nil
+}
+
+// Count sums count_over_time over the whole range, evaluated once at the end
+func (e *lokiEngine) Count(ctx context.Context, ds *Datasource, req QueryRequest, groupBy string) (map[string]float64, error) {
+	rng := formatStep(countRange(req))
+	agg := "sum"
+	if groupBy != "" {
+		agg = "sum by (" + groupBy + ")"
+	}
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf("%s (count_over_time(%s [%s]))", agg, req.Query, rng))
+	params.Set("start", req.End)
+	params.Set("end", req.End)
+	params.Set("step", rng)
+
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, "/loki/api/v1/query_range", params), 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	series, _ := FlattenLokiMatrix(body)
+	counts := map[string]float64{}
+	for _, s := range series {
+		if n := len(s.Points); n > 0 {
+			counts[s.Labels[groupBy]] += s.Points[n-1].Value
+		}
+	}
+	return counts, nil
+}
+
+// Tail proxies the /loki/api/v1/tail websocket and emits every pushed batch
+func (e *lokiEngine) Tail(ctx context.Context, ds *Datasource, req QueryRequest, emit func(rows []map[string]interface{}) error) error {
+	params := url.Values{}
+	params.Set("query", req.Query)
+	if req.Start != "" {
+		params.Set("start", req.Start)
+	}
+	if req.Limit > 0 {
+		params.Set("limit", strconv.Itoa(req.Limit))
+	}
+	tailURL := buildEngineURL(ds.Endpoint, "/loki/api/v1/tail", params)
+	if strings.HasPrefix(tailURL, "https://") {
+		tailURL = "wss://" + strings.TrimPrefix(tailURL, "https://")
+	} else {
+		tailURL = "ws://" + strings.TrimPrefix(tailURL, "http://")
+	}
+
+	wsCfg, err := websocket.NewConfig(tailURL, ds.Endpoint)
+	if err != nil {
+		return err
+	}
+	// Verify the server with the datasource TLS settings (CA, client
+	// certificate, server name, skip verify) as the connection test does
+	wsCfg.TlsConfig = getTestTLSConfig(ds.Config)
+	// Reuse the datasource auth settings for the websocket handshake
+	authReq, _ := http.NewRequest(http.MethodGet, tailURL, nil)
+	ApplyAuthHeaders(authReq, ds.Config)
+	wsCfg.Header = authReq.Header
+
+	conn, err := wsCfg.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	for {
+		var msg struct {
+			Streams []lokiStream `json:"streams"`
+		}
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("loki tail: %w", err)
+		}
+		rows := flattenLokiStreams(msg.Streams)
+		if len(rows) == 0 {
+			continue
+		}
+		if err := emit(rows); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *lokiEngine) Labels(ctx context.Context, ds *Datasource) ([]string, error) {
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, "/loki/api/v1/labels", nil), 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLokiStringList(body), nil
+}
+
+func (e *lokiEngine) LabelValues(ctx context.Context, ds *Datasource, label string) ([]string, error) {
+	apiPath := "/loki/api/v1/label/" + url.PathEscape(label) + "/values"
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, apiPath, nil), 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLokiStringList(body), nil
+}
+
+// CompileFilter compiles the filter into LogQL appended to the base query
+func (e *lokiEngine) CompileFilter(ds *Datasource, req QueryRequest) (QueryRequest, error) {
+	query, err := CompileLogQL(strings.TrimSpace(req.Query), req.Filter, filterLevelField(ds))
+	if err != nil {
+		return req, err
+	}
+	req.Query, req.Filter = query, nil
+	return req, nil
+}
+
+func (e *lokiEngine) Inspect(ds *Datasource, req QueryRequest) (*InspectResult, error) {
+	params := url.Values{}
+	params.Set("query", req.Query)
+	if req.Start != "" {
+		params.Set("start", req.Start)
+	}
+	if req.End != "" {
+		params.Set("end", req.End)
+	}
+	if req.Step != "" {
+		params.Set("step", req.Step)
+	}
+	if req.Direction != "" {
+		params.Set("direction", req.Direction)
+	}
+	return &InspectResult{URL: ds.Endpoint + "/loki/api/v1/query_range?" + params.Encode()}, nil
+}
+
+func (e *lokiEngine) TestConnection(ctx context.Context, ds *Datasource) (*ConnectionResult, error) {
+	reqURL := ds.Endpoint
+	if !hasPath(reqURL) {
+		reqURL = reqURL + "/loki/api/v1/labels?limit=1"
+	}
+	return probeEndpoint(ctx, ds, reqURL)
+}
+
+// decodeLokiStringList extracts the {"data": [...]} list returned by the label APIs
+func decodeLokiStringList(body []byte) []string {
+	var obj struct {
+		Data []string `json:"data"`
+	}
+	_ = json.Unmarshal(body, &obj)
+	if obj.Data == nil {
+		return []string{}
+	}
+	return obj.Data
+}
+
+// lokiStream is a single stream of a query_range or tail response
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][]string        `json:"values"`
+}
+
+// FlattenLokiToRows converts a query_range streams response into table rows
+func FlattenLokiToRows(body []byte) []map[string]interface{} {
+	var resp struct {
+		Data struct {
+			Result []lokiStream `json:"result"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	return flattenLokiStreams(resp.Data.Result)
+}
+
+// FlattenLokiMatrix converts a metric query_range response into time series.
+// ok is false when the response is not a matrix (i.e. a streams result).
+func FlattenLokiMatrix(body []byte) (series []TimeSeries, ok bool) {
+	var resp struct {
+		Data struct {
+			ResultType string `json:"resultType"`
+			Result     []struct {
+				Metric map[string]string `json:"metric"`
+				Values [][]interface{}   `json:"values"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Data.ResultType != "matrix" {
+		return nil, false
+	}
+	series = make([]TimeSeries, 0, len(resp.Data.Result))
+	for _, r := range resp.Data.Result {
+		ts := TimeSeries{Labels: r.Metric, Points: make([]SeriesPoint, 0, len(r.Values))}
+		if ts.Labels == nil {
+			ts.Labels = map[string]string{}
+		}
+		for _, v := range r.Values {
+			if len(v) < 2 {
+				continue
+			}
+			sec, _ := v[0].(float64)
+			raw, _ := v[1].(string)
+			value, _ := strconv.ParseFloat(raw, 64)
+			ts.Points = append(ts.Points, SeriesPoint{Timestamp: int64(sec * 1000), Value: value})
+		}
+		series = append(series, ts)
+	}
+	return series, true
+}
+
+func flattenLokiStreams(streams []lokiStream) []map[string]interface{} {
+	items := make([]map[string]interface{}, 0)
+	for _, series := range streams {
+		for _, val := range series.Values {
+			if len(val) < 2 {
+				continue
+			}
+			row := make(map[string]interface{})
+			row["timestamp"] = val[0]
+			row["message"] = val[1]
+			for k, v := range series.Stream {
+				row[k] = v
+			}
+			items = append(items, row)
+		}
+	}
+	return items
+}
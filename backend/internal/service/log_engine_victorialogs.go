@@ -0,0 +1,336 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterEngine(&victoriaLogsEngine{})
+}
+
+type victoriaLogsEngine struct{}
+
+func (e *victoriaLogsEngine) Name() string { return "victorialogs" }
+
+func (e *victoriaLogsEngine) queryParams(req QueryRequest) url.Values {
+	params := url.Values{}
+	query := req.Query
+	if query == "" {
+		query = "*"
+	}
+	params.Set("query", query)
+	if req.Start != "" {
+		params.Set("start", req.Start)
+	}
+	if req.End != "" {
+		params.Set("end", req.End)
+	}
+	params.Set("limit", strconv.Itoa(req.Limit))
+	return params
+}
+
+// Query returns the newest rows. A cursor continues with the window that ends
+// at the oldest row seen so far, inclusive, since more rows may share that
+// timestamp; the rows already returned there are dropped.
+func (e *victoriaLogsEngine) Query(ctx context.Context, ds *Datasource, req QueryRequest) (*QueryResult, error) {
+	limit := req.Limit
+	var cur *queryCursor
+	var edge time.Time
+	seen := map[string]bool{}
+	if req.Cursor != "" {
+		var err error
+		if cur, err = decodeCursor(e.Name(), req.Cursor); err != nil {
+			return nil, err
+		}
+		if edge, err = time.Parse(time.RFC3339Nano, cur.Timestamp); err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		req.End = cur.Timestamp
+		for _, k := range cur.Seen {
+			seen[k] = true
+		}
+		if req.Limit > 0 {
+			req.Limit += len(seen)
+		}
+	}
+	reqURL := buildEngineURL(ds.Endpoint, "/select/logsql/query", e.queryParams(req))
+	body, err := engineGet(ctx, ds, reqURL, 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	rows := FlattenVictoriaLogsToRows(body)
+	result := &QueryResult{Items: make([]map[string]interface{}, 0, len(rows))}
+	for _, row := range rows {
+		if cur != nil && rowAt(row, edge) && seen[pageRowKey(row)] {
+			continue
+		}
+		result.Items = append(result.Items, row)
+	}
+	if limit > 0 && len(rows) >= req.Limit {
+		if oldest, ok := oldestRFC3339(result.Items); ok {
+			next := queryCursor{Engine: e.Name(), Timestamp: oldest.Format(time.RFC3339Nano)}
+			if cur != nil && oldest.Equal(edge) {
+				next.Seen = append(next.Seen, cur.Seen...)
+			}
+			for _, row := range result.Items {
+				if rowAt(row, oldest) {
+					next.Seen = append(next.Seen, pageRowKey(row))
+				}
+			}
+			result.NextCursor = encodeCursor(next)
+		}
+	}
+	return result, nil
+}
+
+// rowAt reports whether the RFC3339 timestamp of the row is t
+func rowAt(row map[string]interface{}, t time.Time) bool {
+	s, _ := row["timestamp"].(string)
+	rt, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil && rt.Equal(t)
+}
+
+// oldestRFC3339 returns the earliest RFC3339 row timestamp
+func oldestRFC3339(rows []map[string]interface{}) (time.Time, bool) {
+	var oldest time.Time
+	found := false
+	for _, row := range rows {
+		s, _ := row["timestamp"].(string)
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			continue
+		}
+		if !found || t.Before(oldest) {
+			oldest = t
+			found = true
+		}
+	}
+	return oldest, found
+}
+
+// Volume counts entries with `stats by (_time:step, level) count()`
+func (e *victoriaLogsEngine) Volume(ctx context.Context, ds *Datasource, req QueryRequest, step time.Duration) (*VolumeResult, error) {
+	levelField := configString(configSection(ds.Config, "logs"), "levelField")
+	if levelField == "" {
+		levelField = "level"
+	}
+	query := req.Query
+	if query == "" {
+		query = "*"
+	}
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf("%s | stats by (_time:%s, %s) count() hits", query, formatStep(step), levelField))
+	params.Set("start", req.Start)
+	params.Set("end", req.End)
+
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, "/select/logsql/query", params), 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	vc := newVolumeCollector()
+	for _, line := range strings.Split(string(body), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, configString(entry, "_time"))
+		if err != nil {
+			continue
+		}
+		hits, _ := strconv.ParseFloat(fmt.Sprintf("%v", entry["hits"]), 64)
+		vc.add(configString(entry, levelField), t.UnixMilli(), hits)
+	}
+	return vc.result(step), nil
+}
+
+// Count runs `stats by (field) count()` over the time range
+func (e *victoriaLogsEngine) Count(ctx context.Context, ds *Datasource, req QueryRequest, groupBy string) (map[string]float64, error) {
+	query := req.Query
+	if query == "" {
+		query = "*"
+	}
+	by := ""
+	if groupBy != "" {
+		by = "by (" + strconv.Quote(groupBy) + ") "
+	}
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf("%s | stats %scount() hits", query, by))
+	params.Set("start", req.Start)
+	params.Set("end", req.End)
+
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, "/select/logsql/query", params), 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]float64{}
+	for _, line := range strings.Split(string(body), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		hits, _ := strconv.ParseFloat(fmt.Sprintf("%v", entry["hits"]), 64)
+		key := ""
+		if groupBy != "" {
+			key = configString(entry, groupBy)
+		}
+		counts[key] += hits
+	}
+	return counts, nil
+}
+
+// Tail streams the JSON lines returned by /select/logsql/tail
+func (e *victoriaLogsEngine) Tail(ctx context.Context, ds *Datasource, req QueryRequest, emit func(rows []map[string]interface{}) error) error {
+	params := url.Values{}
+	query := req.Query
+	if query == "" {
+		query = "*"
+	}
+	params.Set("query", query)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, buildEngineURL(ds.Endpoint, "/select/logsql/tail", params), nil)
+	if err != nil {
+		return err
+	}
+	ApplyAuthHeaders(httpReq, ds.Config)
+	// No client timeout: the stream lives until the caller cancels ctx
+	resp, err := CreateHTTPClient(ds.Config, 0).Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("victorialogs error: %s", string(body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		rows := FlattenVictoriaLogsToRows(scanner.Bytes())
+		if len(rows) == 0 {
+			continue
+		}
+		if err := emit(rows); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// vlValuesLimit caps the number of values returned by LabelValues
+const vlValuesLimit = 50
+
+// Labels lists the field names seen over the last hour via /select/logsql/field_names
+func (e *victoriaLogsEngine) Labels(ctx context.Context, ds *Datasource) ([]string, error) {
+	start, end := defaultTimeRange("", "")
+	params := url.Values{"query": {"*"}, "start": {start}, "end": {end}}
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, "/select/logsql/field_names", params), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return decodeVictoriaLogsValues(body)
+}
+
+// LabelValues lists the most frequent values of a field over the last hour
+// via /select/logsql/field_values
+func (e *victoriaLogsEngine) LabelValues(ctx context.Context, ds *Datasource, label string) ([]string, error) {
+	start, end := defaultTimeRange("", "")
+	params := url.Values{"query": {"*"}, "field": {label}, "start": {start}, "end": {end}, "limit": {strconv.Itoa(vlValuesLimit)}}
+	body, err := engineGet(ctx, ds, buildEngineURL(ds.Endpoint, "/select/logsql/field_values", params), 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return decodeVictoriaLogsValues(body)
+}
+
+// decodeVictoriaLogsValues reads {"values":[{"value":"..","hits":N}]} ordered by hits
+func decodeVictoriaLogsValues(body []byte) ([]string, error) {
+	var resp struct {
+		Values []struct {
+			Value string `json:"value"`
+			Hits  int64  `json:"hits"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(resp.Values, func(i, j int) bool { return resp.Values[i].Hits > resp.Values[j].Hits })
+	out := make([]string, 0, len(resp.Values))
+	for _, v := range resp.Values {
+		out = append(out, v.Value)
+	}
+	return out, nil
+}
+
+// CompileFilter compiles the filter into LogsQL ANDed with the base query
+func (e *victoriaLogsEngine) CompileFilter(ds *Datasource, req QueryRequest) (QueryRequest, error) {
+	query, err := CompileLogsQL(req.Query, req.Filter, filterLevelField(ds))
+	if err != nil {
+		return req, err
+	}
+	req.Query, req.Filter = query, nil
+	return req, nil
+}
+
+func (e *victoriaLogsEngine) Inspect(ds *Datasource, req QueryRequest) (*InspectResult, error) {
+	params := url.Values{}
+	params.Set("query", req.Query)
+	if req.Start != "" {
+		params.Set("start", req.Start)
+	}
+	if req.End != "" {
+		params.Set("end", req.End)
+	}
+	return &InspectResult{URL: ds.Endpoint + "/select/logsql/query?" + params.Encode()}, nil
+}
+
+func (e *victoriaLogsEngine) TestConnection(ctx context.Context, ds *Datasource) (*ConnectionResult, error) {
+	return probeEndpoint(ctx, ds, ds.Endpoint)
+}
+
+// FlattenVictoriaLogsToRows converts a JSON lines response into table rows
+func FlattenVictoriaLogsToRows(body []byte) []map[string]interface{} {
+	items := make([]map[string]interface{}, 0)
+	lines := strings.Split(string(body), "\n")
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			continue
+		}
+		row := make(map[string]interface{})
+		row["__raw"] = entry
+		if t, ok := entry["_time"].(string); ok {
+			row["timestamp"] = t
+		}
+		if msg, ok := entry["_msg"].(string); ok {
+			row["message"] = msg
+		} else {
+			row["message"] = line
+		}
+		for k, v := range entry {
+			if k != "_time" && k != "_msg" {
+				row[k] = v
+			}
+		}
+		items = append(items, row)
+	}
+	return items
+}
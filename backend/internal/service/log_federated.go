@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FederatedSource is one datasource taking part in a federated search. Each
+// source carries its own query since engines speak different languages.
+type FederatedSource struct {
+	Engine       string `json:"engine"`
+	DatasourceID string `json:"datasourceId"`
+	Query        string `json:"query"`
+}
+
+// FederatedSourceStatus reports how a single source performed
+type FederatedSourceStatus struct {
+	Engine       string `json:"engine"`
+	DatasourceID string `json:"datasourceId"`
+	Name         string `json:"name"`
+	Count        int    `json:"count"`
+	DurationMs   int64  `json:"durationMs"`
+	Error        string `json:"error,omitempty"`
+}
+
+// FederatedResult is the merged, time ordered result of a federated search
+type FederatedResult struct {
+	Items   []map[string]interface{} `json:"items"`
+	Sources []FederatedSourceStatus  `json:"sources"`
+	// Partial is true when at least one source failed or timed out
+	Partial bool `json:"partial"`
+}
+
+// defaultFederatedTimeout bounds each source when the caller gives no timeout
+const defaultFederatedTimeout = 30 * time.Second
+
+// FederatedQuery fans the search out to every source in parallel, each with its
+// own timeout, and merges the rows newest first. Every row is tagged with a
+// "source" object naming the datasource it came from. Failing sources are
+// reported in Sources instead of failing the whole search.
+func (s *LogService) FederatedQuery(ctx context.Context, sources []FederatedSource, req QueryRequest, timeout time.Duration) *FederatedResult {
+	if timeout <= 0 {
+		timeout = defaultFederatedTimeout
+	}
+	// Pin the time range once so every source searches the same window
+	req.Start, req.End = defaultTimeRange(req.Start, req.End)
+	statuses := make([]FederatedSourceStatus, len(sources))
+	rows := make([][]map[string]interface{}, len(sources))
+
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func(i int, src FederatedSource) {
+			defer wg.Done()
+			status := FederatedSourceStatus{Engine: src.Engine, DatasourceID: src.DatasourceID}
+			started := time.Now()
+			defer func() {
+				status.DurationMs = time.Since(started).Milliseconds()
+				statuses[i] = status
+			}()
+
+			ds, ok := ResolveDatasource(src.Engine, src.DatasourceID)
+			if !ok {
+				status.Error = "no " + src.Engine + " datasource"
+				return
+			}
+			status.DatasourceID = strconv.FormatUint(uint64(ds.Model.ID), 10)
+			status.Name = ds.Model.Name
+
+			srcCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			srcReq := req
+			srcReq.Query = src.Query
+			srcReq.Cursor = ""
+			result, err := s.ExecuteQuery(srcCtx, src.Engine, status.DatasourceID, srcReq)
+			if err != nil {
+				status.Error = err.Error()
+				return
+			}
+			tag := map[string]interface{}{"engine": src.Engine, "datasourceId": status.DatasourceID, "name": ds.Model.Name}
+			for _, row := range result.Items {
+				row["source"] = tag
+			}
+			rows[i] = result.Items
+			status.Count = len(result.Items)
+		}(i, src)
+	}
+	wg.Wait()
+
+	out := &FederatedResult{Items: make([]map[string]interface{}, 0), Sources: statuses}
+	for i := range sources {
+		out.Items = append(out.Items, rows[i]...)
+		if statuses[i].Error != "" {
+			out.Partial = true
+		}
+	}
+	sortRowsNewestFirst(out.Items)
+	if req.Limit > 0 && len(out.Items) > req.Limit {
+		out.Items = out.Items[:req.Limit]
+	}
+	return out
+}
+
+// sortRowsNewestFirst orders normalized rows by timestamp, newest first.
+// Rows with unparseable timestamps sink to the end.
+func sortRowsNewestFirst(rows []map[string]interface{}) {
+	type keyed struct {
+		at  time.Time
+		row map[string]interface{}
+	}
+	list := make([]keyed, len(rows))
+	for i, row := range rows {
+		t, _ := parseTimestamp(row["timestamp"])
+		list[i] = keyed{at: t, row: row}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].at.After(list[j].at) })
+	for i := range list {
+		rows[i] = list[i].row
+	}
+}
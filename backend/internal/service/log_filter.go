@@ -0,0 +1,495 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter operators of the AILAP filter AST
+const (
+	FilterAnd      = "and"
+	FilterOr       = "or"
+	FilterNot      = "not"
+	FilterEq       = "eq"       // Field equals Value
+	FilterNeq      = "neq"      // Field differs from Value
+	FilterRegex    = "regex"    // Field (or the log line when Field is empty) matches Value anywhere, unanchored
+	FilterContains = "contains" // Field (or the log line when Field is empty) contains Value
+	FilterLevel    = "level"    // level is one of Values (canonical Level* names)
+)
+
+// FilterNode is one node of the engine neutral AILAP filter AST. Leaf nodes
+// use Field/Value(s); and/or/not nodes use Children.
+type FilterNode struct {
+	Op       string       `json:"op"`
+	Field    string       `json:"field,omitempty"`
+	Value    string       `json:"value,omitempty"`
+	Values   []string     `json:"values,omitempty"`
+	Children []FilterNode `json:"children,omitempty"`
+}
+
+// Filter is a saved, engine neutral filter: a root node plus optional time
+// bounds (RFC3339) that narrow the query range. It compiles to LogQL, LogsQL
+// and Elasticsearch query DSL, so the same filter runs against any engine.
+type Filter struct {
+	FilterNode
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// FilterCompiler is implemented by engines that can run a Filter. It returns
+// the request rewritten for the engine, e.g. with the filter compiled into Query.
+type FilterCompiler interface {
+	CompileFilter(ds *Datasource, req QueryRequest) (QueryRequest, error)
+}
+
+// applyFilter narrows the time range to the filter bounds and lets the engine
+// compile the filter. Requests without a filter pass through unchanged.
+func applyFilter(e LogEngine, ds *Datasource, req QueryRequest) (QueryRequest, error) {
+	if req.Filter.IsEmpty() {
+		req.Filter = nil
+		return req, nil
+	}
+	if err := req.Filter.applyTimeBounds(&req); err != nil {
+		return req, err
+	}
+	if req.Filter.Op == "" {
+		req.Filter = nil
+		return req, nil
+	}
+	compiler, ok := e.(FilterCompiler)
+	if !ok {
+		return req, fmt.Errorf("engine %s does not support filters", e.Name())
+	}
+	return compiler.CompileFilter(ds, req)
+}
+
+// filterLevelField is the field level conditions match against
+func filterLevelField(ds *Datasource) string {
+	if fields := FieldMappingFromConfig(ds.Config).LevelFields; len(fields) > 0 {
+		return fields[0]
+	}
+	return "level"
+}
+
+// And appends a condition to the root, turning it into an "and" node if needed
+func (f *Filter) And(node FilterNode) {
+	switch {
+	case f.Op == "":
+		f.FilterNode = node
+	case f.Op == FilterAnd:
+		f.Children = append(f.Children, node)
+	default:
+		f.FilterNode = FilterNode{Op: FilterAnd, Children: []FilterNode{f.FilterNode, node}}
+	}
+}
+
+// IsEmpty reports whether the filter has no conditions and no time bounds
+func (f *Filter) IsEmpty() bool {
+	return f == nil || (f.Op == "" && f.Start == "" && f.End == "")
+}
+
+// applyTimeBounds narrows the ns start/end of req to the filter bounds
+func (f *Filter) applyTimeBounds(req *QueryRequest) error {
+	if f.Start != "" {
+		t, err := time.Parse(time.RFC3339Nano, f.Start)
+		if err != nil {
+			return fmt.Errorf("invalid filter start: %w", err)
+		}
+		if cur, err := strconv.ParseInt(req.Start, 10, 64); err != nil || t.UnixNano() > cur {
+			req.Start = strconv.FormatInt(t.UnixNano(), 10)
+		}
+	}
+	if f.End != "" {
+		t, err := time.Parse(time.RFC3339Nano, f.End)
+		if err != nil {
+			return fmt.Errorf("invalid filter end: %w", err)
+		}
+		if cur, err := strconv.ParseInt(req.End, 10, 64); err != nil || t.UnixNano() < cur {
+			req.End = strconv.FormatInt(t.UnixNano(), 10)
+		}
+	}
+	return nil
+}
+
+// levelSpellings returns the raw spellings matching canonical levels, e.g.
+// "warn" -> warn, warning, wrn
+func levelSpellings(levels []string) []string {
+	out := make([]string, 0)
+	for _, want := range levels {
+		want = canonicalLevel(want, nil)
+		for alias, level := range levelAliases {
+			if level == want {
+				out = append(out, alias)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// levelRegex builds a case insensitive, anchored alternation of level spellings
+func levelRegex(levels []string) string {
+	spellings := levelSpellings(levels)
+	for i, s := range spellings {
+		spellings[i] = regexp.QuoteMeta(s)
+	}
+	return "(?i)^(" + strings.Join(spellings, "|") + ")$"
+}
+
+// flattenAnd expands nested "and" nodes into a flat list of terms
+func flattenAnd(n FilterNode) []FilterNode {
+	if n.Op == "" {
+		return nil
+	}
+	if n.Op != FilterAnd {
+		return []FilterNode{n}
+	}
+	terms := make([]FilterNode, 0, len(n.Children))
+	for _, c := range n.Children {
+		terms = append(terms, flattenAnd(c)...)
+	}
+	return terms
+}
+
+// ---- LogQL ----
+
+// CompileLogQL compiles the filter into LogQL. When base is empty the stream
+// selector is built from top-level label equality / regex terms; otherwise
+// every term is appended to base as a pipeline stage.
+func CompileLogQL(base string, f *Filter, levelField string) (string, error) {
+	terms := flattenAnd(f.FilterNode)
+	var matchers, lineStages, labelStages []string
+	for _, t := range terms {
+		if base == "" {
+			if m, ok := logqlSelectorMatcher(t); ok {
+				matchers = append(matchers, m)
+				continue
+			}
+		}
+		stage, isLine, err := logqlStage(t, levelField, false)
+		if err != nil {
+			return "", err
+		}
+		if isLine {
+			lineStages = append(lineStages, stage)
+		} else {
+			labelStages = append(labelStages, stage)
+		}
+	}
+	var sb strings.Builder
+	if base == "" {
+		sb.WriteString("{" + strings.Join(matchers, ",") + "}")
+	} else {
+		sb.WriteString(base)
+	}
+	for _, stage := range append(lineStages, labelStages...) {
+		sb.WriteString(" " + stage)
+	}
+	return sb.String(), nil
+}
+
+// logqlSelectorMatcher renders terms usable inside the stream selector:
+// label equality / regex, possibly negated
+func logqlSelectorMatcher(t FilterNode) (string, bool) {
+	negate := false
+	if t.Op == FilterNot && len(t.Children) == 1 {
+		t, negate = t.Children[0], true
+	}
+	if t.Field == "" || (t.Op != FilterEq && t.Op != FilterNeq && t.Op != FilterRegex) {
+		return "", false
+	}
+	if t.Op == FilterRegex {
+		t.Value = unanchoredRegex(t.Value)
+	}
+	return logqlLabelMatcher(t, negate), true
+}
+
+// unanchoredRegex lets a regex match anywhere in a value. LogQL label
+// matchers are anchored while line filters and LogsQL are not, and a filter
+// must match the same rows on every engine.
+func unanchoredRegex(re string) string {
+	return ".*(?:" + re + ").*"
+}
+
+// logqlLabelMatcher renders field=value, field!=value or field=~regex
+func logqlLabelMatcher(t FilterNode, negate bool) string {
+	op := map[string]string{FilterEq: "=", FilterNeq: "!=", FilterRegex: "=~"}[t.Op]
+	if negate {
+		op = map[string]string{FilterEq: "!=", FilterNeq: "=", FilterRegex: "!~"}[t.Op]
+	}
+	return t.Field + op + strconv.Quote(t.Value)
+}
+
+// logqlStage compiles one term into a line filter (isLine) or a label filter stage
+func logqlStage(t FilterNode, levelField string, negate bool) (stage string, isLine bool, err error) {
+	switch t.Op {
+	case FilterContains:
+		if t.Field == "" {
+			if negate {
+				return "!= " + strconv.Quote(t.Value), true, nil
+			}
+			return "|= " + strconv.Quote(t.Value), true, nil
+		}
+		m := FilterNode{Op: FilterRegex, Field: t.Field, Value: ".*" + regexp.QuoteMeta(t.Value) + ".*"}
+		return "| " + logqlLabelMatcher(m, negate), false, nil
+	case FilterRegex:
+		if t.Field == "" {
+			if negate {
+				return "!~ " + strconv.Quote(t.Value), true, nil
+			}
+			return "|~ " + strconv.Quote(t.Value), true, nil
+		}
+		t.Value = unanchoredRegex(t.Value)
+		return "| " + logqlLabelMatcher(t, negate), false, nil
+	case FilterEq, FilterNeq:
+		if t.Field == "" {
+			return "", false, fmt.Errorf("filter %s requires a field", t.Op)
+		}
+		return "| " + logqlLabelMatcher(t, negate), false, nil
+	case FilterLevel:
+		m := FilterNode{Op: FilterRegex, Field: levelField, Value: levelRegex(t.Values)}
+		return "| " + logqlLabelMatcher(m, negate), false, nil
+	case FilterNot:
+		if len(t.Children) != 1 {
+			return "", false, fmt.Errorf("not filter requires exactly one child")
+		}
+		return logqlStage(t.Children[0], levelField, !negate)
+	case FilterOr:
+		return logqlOr(t, levelField, negate)
+	case FilterAnd:
+		if negate {
+			return "", false, fmt.Errorf("negated and groups are not supported in LogQL")
+		}
+		stages := make([]string, 0, len(t.Children))
+		allLine := true
+		for _, c := range t.Children {
+			stage, line, err := logqlStage(c, levelField, false)
+			if err != nil {
+				return "", false, err
+			}
+			allLine = allLine && line
+			stages = append(stages, stage)
+		}
+		return strings.Join(stages, " "), allLine, nil
+	}
+	return "", false, fmt.Errorf("unsupported filter op: %s", t.Op)
+}
+
+// logqlOr compiles an "or" group. Line terms become one |~ alternation and
+// label terms one label filter expression joined by "or"; mixing is rejected.
+func logqlOr(t FilterNode, levelField string, negate bool) (string, bool, error) {
+	var alternatives, labelExprs []string
+	for _, c := range t.Children {
+		if c.Field == "" && (c.Op == FilterContains || c.Op == FilterRegex) {
+			if c.Op == FilterContains {
+				alternatives = append(alternatives, regexp.QuoteMeta(c.Value))
+			} else {
+				alternatives = append(alternatives, "(?:"+c.Value+")")
+			}
+			continue
+		}
+		stage, isLine, err := logqlStage(c, levelField, negate)
+		if err != nil {
+			return "", false, err
+		}
+		if isLine || !strings.HasPrefix(stage, "| ") {
+			return "", false, fmt.Errorf("unsupported or group in LogQL")
+		}
+		labelExprs = append(labelExprs, strings.TrimPrefix(stage, "| "))
+	}
+	if len(alternatives) > 0 && len(labelExprs) > 0 {
+		return "", false, fmt.Errorf("LogQL cannot mix line and label conditions in one or group")
+	}
+	if len(alternatives) > 0 {
+		op := "|~ "
+		if negate {
+			op = "!~ "
+		}
+		return op + strconv.Quote(strings.Join(alternatives, "|")), true, nil
+	}
+	if len(labelExprs) == 0 {
+		return "", false, fmt.Errorf("empty or filter")
+	}
+	// not (a or b) == (not a) and (not b): negated children are joined by "and"
+	joiner := " or "
+	if negate {
+		joiner = " and "
+	}
+	return "| " + strings.Join(labelExprs, joiner), false, nil
+}
+
+// ---- LogsQL ----
+
+// CompileLogsQL compiles the filter into a VictoriaLogs LogsQL expression
+// and ANDs it with base.
+func CompileLogsQL(base string, f *Filter, levelField string) (string, error) {
+	expr, err := logsqlExpr(f.FilterNode, levelField)
+	if err != nil {
+		return "", err
+	}
+	base = strings.TrimSpace(base)
+	switch {
+	case expr == "":
+		return base, nil
+	case base == "" || base == "*":
+		return expr, nil
+	default:
+		return "(" + base + ") " + expr, nil
+	}
+}
+
+func logsqlField(field string) string {
+	if field == "" {
+		return ""
+	}
+	return strconv.Quote(field) + ":"
+}
+
+func logsqlExpr(n FilterNode, levelField string) (string, error) {
+	switch n.Op {
+	case "":
+		return "", nil
+	case FilterContains:
+		// A quoted word or phrase is word bounded in LogsQL; an unanchored
+		// regex of the literal is the substring match LogQL |= does
+		return logsqlField(n.Field) + "~" + strconv.Quote(regexp.QuoteMeta(n.Value)), nil
+	case FilterRegex:
+		return logsqlField(n.Field) + "~" + strconv.Quote(n.Value), nil
+	case FilterEq, FilterNeq:
+		if n.Field == "" {
+			return "", fmt.Errorf("filter %s requires a field", n.Op)
+		}
+		expr := logsqlField(n.Field) + "=" + strconv.Quote(n.Value)
+		if n.Op == FilterNeq {
+			expr = "!" + expr
+		}
+		return expr, nil
+	case FilterLevel:
+		return logsqlField(levelField) + "~" + strconv.Quote(levelRegex(n.Values)), nil
+	case FilterNot:
+		if len(n.Children) != 1 {
+			return "", fmt.Errorf("not filter requires exactly one child")
+		}
+		inner, err := logsqlExpr(n.Children[0], levelField)
+		if err != nil {
+			return "", err
+		}
+		return "!(" + inner + ")", nil
+	case FilterAnd, FilterOr:
+		parts := make([]string, 0, len(n.Children))
+		for _, c := range n.Children {
+			p, err := logsqlExpr(c, levelField)
+			if err != nil {
+				return "", err
+			}
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		if len(parts) == 0 {
+			return "", nil
+		}
+		return "(" + strings.Join(parts, " "+n.Op+" ") + ")", nil
+	}
+	return "", fmt.Errorf("unsupported filter op: %s", n.Op)
+}
+
+// ---- Elasticsearch query DSL ----
+
+// CompileElasticsearchDSL compiles the filter into a bool query clause.
+// Line conditions (no field) search messageField, or every field when the
+// datasource keeps the whole _source as message. Contains conditions are
+// wildcard (substring) matches like LogQL |=; on analyzed text fields they
+// match single terms, so point messageField at a keyword field to match
+// across words.
+func CompileElasticsearchDSL(f *Filter, levelField, messageField string) (map[string]interface{}, error) {
+	return esClause(f.FilterNode, levelField, messageField)
+}
+
+func esClause(n FilterNode, levelField, messageField string) (map[string]interface{}, error) {
+	switch n.Op {
+	case "":
+		return map[string]interface{}{"match_all": map[string]interface{}{}}, nil
+	case FilterContains:
+		if n.Field == "" && (messageField == "" || messageField == "_source") {
+			query := "*" + esQueryStringEscape(n.Value) + "*"
+			return map[string]interface{}{"query_string": map[string]interface{}{"query": query, "default_field": "*", "lenient": true}}, nil
+		}
+		field := n.Field
+		if field == "" {
+			field = messageField
+		}
+		return map[string]interface{}{"wildcard": map[string]interface{}{field: map[string]interface{}{"value": "*" + esWildcardEscape(n.Value) + "*"}}}, nil
+	case FilterRegex:
+		field := n.Field
+		if field == "" {
+			if messageField == "" || messageField == "_source" {
+				return nil, fmt.Errorf("line regex filters need a message field on elasticsearch datasources")
+			}
+			field = messageField
+		}
+		// Lucene regexps are anchored and have no (?:) groups
+		return map[string]interface{}{"regexp": map[string]interface{}{field: ".*(" + n.Value + ").*"}}, nil
+	case FilterEq, FilterNeq:
+		if n.Field == "" {
+			return nil, fmt.Errorf("filter %s requires a field", n.Op)
+		}
+		term := map[string]interface{}{"term": map[string]interface{}{n.Field: n.Value}}
+		if n.Op == FilterNeq {
+			return map[string]interface{}{"bool": map[string]interface{}{"must_not": []interface{}{term}}}, nil
+		}
+		return term, nil
+	case FilterLevel:
+		values := make([]string, 0)
+		// terms is case sensitive: lower, UPPER and Title spellings
+		for _, s := range levelSpellings(n.Values) {
+			values = append(values, s, strings.ToUpper(s), strings.ToUpper(s[:1])+s[1:])
+		}
+		return map[string]interface{}{"terms": map[string]interface{}{levelField: values}}, nil
+	case FilterNot:
+		if len(n.Children) != 1 {
+			return nil, fmt.Errorf("not filter requires exactly one child")
+		}
+		inner, err := esClause(n.Children[0], levelField, messageField)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"bool": map[string]interface{}{"must_not": []interface{}{inner}}}, nil
+	case FilterAnd, FilterOr:
+		clauses := make([]interface{}, 0, len(n.Children))
+		for _, c := range n.Children {
+			clause, err := esClause(c, levelField, messageField)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, clause)
+		}
+		if n.Op == FilterAnd {
+			return map[string]interface{}{"bool": map[string]interface{}{"must": clauses}}, nil
+		}
+		return map[string]interface{}{"bool": map[string]interface{}{"should": clauses, "minimum_should_match": 1}}, nil
+	}
+	return nil, fmt.Errorf("unsupported filter op: %s", n.Op)
+}
+
+// esWildcardEscape escapes the wildcard query metacharacters * ? and \
+func esWildcardEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`).Replace(v)
+}
+
+// esQueryStringEscape escapes the query_string reserved characters and
+// whitespace, so the value stays one term
+func esQueryStringEscape(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		if strings.ContainsRune(`+-=&|><!(){}[]^"~*?:\/ `, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// filterCases run one engine neutral filter through every compiler. Contains
+// is a substring match and regex unanchored on all three engines, so "time"
+// also matches "timeout".
+var filterCases = []struct {
+	name   string
+	node   FilterNode
+	logql  string
+	logsql string
+	es     string
+}{
+	{
+		name:   "contains",
+		node:   FilterNode{Op: FilterContains, Value: "time"},
+		logql:  `{app="api"} |= "time"`,
+		logsql: `~"time"`,
+		es:     `{"wildcard":{"message":{"value":"*time*"}}}`,
+	},
+	{
+		name:   "contains escapes metacharacters",
+		node:   FilterNode{Op: FilterContains, Value: "a.b*"},
+		logql:  `{app="api"} |= "a.b*"`,
+		logsql: `~"a\\.b\\*"`,
+		es:     `{"wildcard":{"message":{"value":"*a.b\\**"}}}`,
+	},
+	{
+		name: "and",
+		node: FilterNode{Op: FilterAnd, Children: []FilterNode{
+			{Op: FilterEq, Field: "service", Value: "web"},
+			{Op: FilterContains, Value: "connection refused"},
+		}},
+		logql:  `{app="api"} |= "connection refused" | service="web"`,
+		logsql: `("service":="web" and ~"connection refused")`,
+		es:     `{"bool":{"must":[{"term":{"service":"web"}},{"wildcard":{"message":{"value":"*connection refused*"}}}]}}`,
+	},
+	{
+		name: "or",
+		node: FilterNode{Op: FilterOr, Children: []FilterNode{
+			{Op: FilterContains, Value: "timeout"},
+			{Op: FilterRegex, Value: `5\d\d`},
+		}},
+		logql:  `{app="api"} |~ "timeout|(?:5\\d\\d)"`,
+		logsql: `(~"timeout" or ~"5\\d\\d")`,
+		es:     `{"bool":{"minimum_should_match":1,"should":[{"wildcard":{"message":{"value":"*timeout*"}}},{"regexp":{"message":".*(5\\d\\d).*"}}]}}`,
+	},
+	{
+		name:   "field regex is unanchored",
+		node:   FilterNode{Op: FilterRegex, Field: "reason", Value: "timeout|refused"},
+		logql:  `{app="api"} | reason=~".*(?:timeout|refused).*"`,
+		logsql: `"reason":~"timeout|refused"`,
+		es:     `{"regexp":{"reason":".*(timeout|refused).*"}}`,
+	},
+	{
+		name:   "not",
+		node:   FilterNode{Op: FilterNot, Children: []FilterNode{{Op: FilterContains, Value: "healthcheck"}}},
+		logql:  `{app="api"} != "healthcheck"`,
+		logsql: `!(~"healthcheck")`,
+		es:     `{"bool":{"must_not":[{"wildcard":{"message":{"value":"*healthcheck*"}}}]}}`,
+	},
+	{
+		name:   "neq",
+		node:   FilterNode{Op: FilterNeq, Field: "env", Value: "prod"},
+		logql:  `{app="api"} | env!="prod"`,
+		logsql: `!"env":="prod"`,
+		es:     `{"bool":{"must_not":[{"term":{"env":"prod"}}]}}`,
+	},
+	{
+		name:   "level",
+		node:   FilterNode{Op: FilterLevel, Values: []string{"error"}},
+		logql:  `{app="api"} | level=~"(?i)^(eror|err|error|severe)$"`,
+		logsql: `"level":~"(?i)^(eror|err|error|severe)$"`,
+		es:     `{"terms":{"level":["eror","EROR","Eror","err","ERR","Err","error","ERROR","Error","severe","SEVERE","Severe"]}}`,
+	},
+}
+
+func TestCompileLogQL(t *testing.T) {
+	for _, tc := range filterCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CompileLogQL(`{app="api"}`, &Filter{FilterNode: tc.node}, "level")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.logql {
+				t.Errorf("got %s, want %s", got, tc.logql)
+			}
+		})
+	}
+}
+
+func TestCompileLogQLSelector(t *testing.T) {
+	f := &Filter{FilterNode: FilterNode{Op: FilterAnd, Children: []FilterNode{
+		{Op: FilterEq, Field: "app", Value: "api"},
+		{Op: FilterNeq, Field: "env", Value: "prod"},
+		{Op: FilterContains, Value: "time"},
+	}}}
+	got, err := CompileLogQL("", f, "level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{app="api",env!="prod"} |= "time"`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestCompileLogsQL(t *testing.T) {
+	for _, tc := range filterCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CompileLogsQL("*", &Filter{FilterNode: tc.node}, "level")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.logsql {
+				t.Errorf("got %s, want %s", got, tc.logsql)
+			}
+		})
+	}
+}
+
+func TestCompileElasticsearchDSL(t *testing.T) {
+	for _, tc := range filterCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clause, err := CompileElasticsearchDSL(&Filter{FilterNode: tc.node}, "level", "message")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(clause)
+			if string(got) != tc.es {
+				t.Errorf("got %s, want %s", got, tc.es)
+			}
+		})
+	}
+}
+
+func TestCompileElasticsearchDSLWholeSource(t *testing.T) {
+	f := &Filter{FilterNode: FilterNode{Op: FilterContains, Value: "connection refused"}}
+	clause, err := CompileElasticsearchDSL(f, "level", "_source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(clause)
+	if want := `{"query_string":{"default_field":"*","lenient":true,"query":"*connection\\ refused*"}}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := CompileElasticsearchDSL(&Filter{FilterNode: FilterNode{Op: FilterRegex, Value: "x"}}, "level", "_source"); err == nil {
+		t.Error("line regex without a message field should fail")
+	}
+}
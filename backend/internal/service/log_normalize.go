@@ -0,0 +1,282 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Canonical log levels produced by NormalizeEntry
+const (
+	LevelTrace   = "trace"
+	LevelDebug   = "debug"
+	LevelInfo    = "info"
+	LevelWarn    = "warn"
+	LevelError   = "error"
+	LevelFatal   = "fatal"
+	LevelUnknown = "unknown"
+)
+
+// levelAliases maps lowercased level spellings to the canonical enum
+var levelAliases = map[string]string{
+	"trace": LevelTrace, "trc": LevelTrace,
+	"debug": LevelDebug, "dbg": LevelDebug,
+	"info": LevelInfo, "inf": LevelInfo, "information": LevelInfo, "informational": LevelInfo, "notice": LevelInfo,
+	"warn": LevelWarn, "warning": LevelWarn, "wrn": LevelWarn,
+	"error": LevelError, "err": LevelError, "eror": LevelError, "severe": LevelError,
+	"fatal": LevelFatal, "critical": LevelFatal, "crit": LevelFatal, "panic": LevelFatal, "emerg": LevelFatal, "emergency": LevelFatal, "alert": LevelFatal,
+}
+
+// defaultLevelFields are checked when a datasource has no level mapping rules
+var defaultLevelFields = []string{"level", "severity", "log.level", "lvl", "loglevel", "levelname", "detected_level", "severity_text"}
+
+// messageLevelPattern detects a level keyword inside the message text
+var messageLevelPattern = regexp.MustCompile(`(?i)\b(trace|debug|info|notice|warn|warning|error|err|fatal|critical|crit|panic)\b`)
+
+// FieldMapping holds the per-datasource rules used to detect level and message.
+// It is read from the datasource config:
+//
+//	"normalize": {"levelFields": ["severity"], "messageFields": ["msg"], "levelMap": {"E": "error"}}
+//
+// The elasticsearch logs.levelField / logs.messageField settings are honoured as well.
+type FieldMapping struct {
+	LevelFields   []string
+	MessageFields []string
+	LevelMap      map[string]string
+}
+
+// FieldMappingFromConfig reads the normalization rules of a datasource config
+func FieldMappingFromConfig(cfg map[string]interface{}) FieldMapping {
+	var m FieldMapping
+	norm := configSection(cfg, "normalize")
+	m.LevelFields = configStrings(norm, "levelFields")
+	m.MessageFields = configStrings(norm, "messageFields")
+	if lm, ok := norm["levelMap"].(map[string]interface{}); ok {
+		m.LevelMap = map[string]string{}
+		for k, v := range lm {
+			if s, ok := v.(string); ok {
+				m.LevelMap[strings.ToLower(k)] = strings.ToLower(s)
+			}
+		}
+	}
+	logsCfg := configSection(cfg, "logs")
+	if v := configString(logsCfg, "levelField"); v != "" {
+		m.LevelFields = append(m.LevelFields, v)
+	}
+	if v := configString(logsCfg, "messageField"); v != "" && v != "_source" {
+		m.MessageFields = append(m.MessageFields, v)
+	}
+	return m
+}
+
+// configStrings reads a string list from a decoded JSON config map
+func configStrings(m map[string]interface{}, key string) []string {
+	list, _ := m[key].([]interface{})
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// NormalizeEntry converts a flattened engine row into the canonical record:
+//
+//	timestamp  RFC3339Nano in UTC (original value kept when unparseable)
+//	level      one of the Level* constants
+//	message    the log line
+//	labels     stream labels / extra fields
+//	__raw      the original payload
+//	source     the originating datasource, only set by federated search
+//
+// It is idempotent, so rows that were already normalized pass through unchanged.
+func (s *LogService) NormalizeEntry(entry map[string]interface{}, mapping FieldMapping) map[string]interface{} {
+	raw, hasRaw := entry["__raw"]
+	rawMap, _ := raw.(map[string]interface{})
+
+	labels := map[string]interface{}{}
+	if existing, ok := entry["labels"].(map[string]interface{}); ok {
+		for k, v := range existing {
+			labels[k] = v
+		}
+	}
+	for k, v := range entry {
+		switch k {
+		case "timestamp", "level", "message", "labels", "__raw", "source":
+			continue
+		}
+		labels[k] = v
+	}
+
+	message := ""
+	for _, field := range mapping.MessageFields {
+		if v, ok := lookupField(entry, rawMap, field); ok {
+			message = v
+			break
+		}
+	}
+	if message == "" {
+		message = stringValue(entry["message"])
+	}
+
+	levelValue := ""
+	for _, field := range append(append([]string{}, mapping.LevelFields...), defaultLevelFields...) {
+		if v, ok := lookupField(entry, rawMap, field); ok {
+			levelValue = v
+			break
+		}
+	}
+	level := canonicalLevel(levelValue, mapping.LevelMap)
+	if level == LevelUnknown {
+		if match := messageLevelPattern.FindString(message); match != "" {
+			level = canonicalLevel(match, mapping.LevelMap)
+		}
+	}
+
+	if !hasRaw {
+		raw = entry["message"]
+	}
+
+	out := map[string]interface{}{
+		"timestamp": normalizeTimestamp(entry["timestamp"]),
+		"level":     level,
+		"message":   message,
+		"labels":    labels,
+		"__raw":     raw,
+	}
+	// Datasource tag added by federated search
+	if source, ok := entry["source"]; ok {
+		out["source"] = source
+	}
+	return out
+}
+
+// NormalizeRows applies NormalizeEntry to every row in place
+func (s *LogService) NormalizeRows(rows []map[string]interface{}, mapping FieldMapping) {
+	for i, row := range rows {
+		rows[i] = s.NormalizeEntry(row, mapping)
+	}
+}
+
+// lookupField finds a field in the row, its labels, or the raw payload.
+// Dotted names ("log.level") are resolved as nested objects in the payload.
+func lookupField(entry, raw map[string]interface{}, field string) (string, bool) {
+	if v, ok := entry[field]; ok && field != "labels" && field != "__raw" {
+		if s := stringValue(v); s != "" {
+			return s, true
+		}
+	}
+	if labels, ok := entry["labels"].(map[string]interface{}); ok {
+		if s := stringValue(labels[field]); s != "" {
+			return s, true
+		}
+	}
+	if raw == nil {
+		return "", false
+	}
+	if s := stringValue(raw[field]); s != "" {
+		return s, true
+	}
+	var cur interface{} = raw
+	for _, part := range strings.Split(field, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		cur = m[part]
+	}
+	if s := stringValue(cur); s != "" {
+		return s, true
+	}
+	return "", false
+}
+
+func stringValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case map[string]interface{}, []interface{}:
+		return ""
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+// canonicalLevel maps a raw level value to the fixed enum
+func canonicalLevel(value string, custom map[string]string) string {
+	v := strings.ToLower(strings.TrimSpace(value))
+	if v == "" {
+		return LevelUnknown
+	}
+	if mapped, ok := custom[v]; ok {
+		v = mapped
+	}
+	if level, ok := levelAliases[v]; ok {
+		return level
+	}
+	return LevelUnknown
+}
+
+// timestampLayouts are tried in order for non numeric timestamps
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006/01/02 15:04:05",
+	time.RFC1123Z,
+}
+
+// normalizeTimestamp converts ns/us/ms/s epochs and common date layouts to
+// RFC3339Nano UTC. Unparseable values are returned as their string form.
+func normalizeTimestamp(v interface{}) string {
+	t, ok := parseTimestamp(v)
+	if !ok {
+		return stringValue(v)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTimestamp(v interface{}) (time.Time, bool) {
+	var s string
+	switch t := v.(type) {
+	case float64:
+		s = strconv.FormatFloat(t, 'f', -1, 64)
+	case int64:
+		s = strconv.FormatInt(t, 10)
+	case string:
+		s = strings.TrimSpace(t)
+	default:
+		return time.Time{}, false
+	}
+	if s == "" {
+		return time.Time{}, false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case len(s) >= 18:
+			return time.Unix(0, n), true
+		case len(s) >= 15:
+			return time.UnixMicro(n), true
+		case len(s) >= 12:
+			return time.UnixMilli(n), true
+		default:
+			return time.Unix(n, 0), true
+		}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LogPattern is a message template mined from log rows
+type LogPattern struct {
+	Pattern   string                   `json:"pattern"`
+	Count     int                      `json:"count"`
+	FirstSeen string                   `json:"firstSeen"`
+	LastSeen  string                   `json:"lastSeen"`
+	Levels    map[string]int           `json:"levels"`
+	Samples   []map[string]interface{} `json:"samples"`
+}
+
+// Drain parameters: tokens compared in the prefix tree, the share of equal
+// tokens needed to join a cluster, and the number of samples kept per pattern
+const (
+	drainDepth        = 2
+	drainSimilarity   = 0.5
+	drainMaxChildren  = 100
+	patternMaxSamples = 3
+	patternWildcard   = "<*>"
+)
+
+// patternMasks replace variable tokens before clustering, most specific first
+var patternMasks = []struct {
+	re   *regexp.Regexp
+	mask string
+}{
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), "<UUID>"},
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`), "<TS>"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b`), "<IP>"},
+	{regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`), "<EMAIL>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), "<HEX>"},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{16,}\b`), "<HEX>"},
+	{regexp.MustCompile(`\b\d+(?:\.\d+)?(?:ms|s|m|h|us|µs|ns|b|kb|mb|gb|%)?\b`), "<NUM>"},
+}
+
+// maskTokens replaces well known variable parts of a message
+func maskTokens(msg string) string {
+	for _, m := range patternMasks {
+		msg = m.re.ReplaceAllString(msg, m.mask)
+	}
+	return msg
+}
+
+// drainCluster is one template and the rows it absorbed
+type drainCluster struct {
+	tokens  []string
+	pattern *LogPattern
+}
+
+// drainNode is a node of the Drain prefix tree
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*drainCluster
+}
+
+// PatternMiner clusters log messages into templates with the Drain algorithm
+// (fixed depth prefix tree keyed by token count and leading tokens, then the
+// most similar template in the leaf). Use NewPatternMiner, Add rows, then Patterns.
+type PatternMiner struct {
+	root     *drainNode
+	clusters []*drainCluster
+}
+
+func NewPatternMiner() *PatternMiner {
+	return &PatternMiner{root: &drainNode{children: map[string]*drainNode{}}}
+}
+
+// Add assigns a normalized row to a pattern and returns that pattern
+func (pm *PatternMiner) Add(row map[string]interface{}) *LogPattern {
+	tokens := strings.Fields(maskTokens(stringValue(row["message"])))
+	leaf := pm.leaf(tokens)
+
+	var best *drainCluster
+	bestSim := -1.0
+	for _, c := range leaf.clusters {
+		if sim := drainSimilarityOf(c.tokens, tokens); sim > bestSim {
+			best, bestSim = c, sim
+		}
+	}
+	if best == nil || bestSim < drainSimilarity {
+		best = &drainCluster{tokens: tokens, pattern: &LogPattern{Levels: map[string]int{}}}
+		leaf.clusters = append(leaf.clusters, best)
+		pm.clusters = append(pm.clusters, best)
+	} else {
+		for i, t := range tokens {
+			if best.tokens[i] != t {
+				best.tokens[i] = patternWildcard
+			}
+		}
+	}
+
+	p := best.pattern
+	p.Count++
+	ts, _ := row["timestamp"].(string)
+	if ts != "" && (p.FirstSeen == "" || ts < p.FirstSeen) {
+		p.FirstSeen = ts
+	}
+	if ts > p.LastSeen {
+		p.LastSeen = ts
+	}
+	if level, _ := row["level"].(string); level != "" {
+		p.Levels[level]++
+	}
+	if len(p.Samples) < patternMaxSamples {
+		p.Samples = append(p.Samples, row)
+	}
+	return p
+}
+
+// leaf walks the prefix tree by token count and the first drainDepth tokens.
+// Tokens holding digits go to the wildcard branch since they are likely variables.
+func (pm *PatternMiner) leaf(tokens []string) *drainNode {
+	node := pm.child(pm.root, strconv.Itoa(len(tokens)))
+	for i := 0; i < drainDepth && i < len(tokens); i++ {
+		key := tokens[i]
+		if strings.ContainsAny(key, "0123456789") {
+			key = patternWildcard
+		}
+		if _, ok := node.children[key]; !ok && len(node.children) >= drainMaxChildren {
+			key = patternWildcard
+		}
+		node = pm.child(node, key)
+	}
+	return node
+}
+
+func (pm *PatternMiner) child(node *drainNode, key string) *drainNode {
+	c, ok := node.children[key]
+	if !ok {
+		c = &drainNode{children: map[string]*drainNode{}}
+		node.children[key] = c
+	}
+	return c
+}
+
+// drainSimilarityOf is the share of positions where template and tokens agree
+func drainSimilarityOf(template, tokens []string) float64 {
+	if len(template) == 0 {
+		return 1
+	}
+	same := 0
+	for i, t := range template {
+		if t == tokens[i] || t == patternWildcard {
+			same++
+		}
+	}
+	return float64(same) / float64(len(template))
+}
+
+// Patterns returns the mined patterns, most frequent first
+func (pm *PatternMiner) Patterns() []*LogPattern {
+	out := make([]*LogPattern, 0, len(pm.clusters))
+	for _, c := range pm.clusters {
+		c.pattern.Pattern = strings.Join(c.tokens, " ")
+		out = append(out, c.pattern)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	return out
+}
+
+// patternSignatureTokens is how many leading tokens make up a pattern signature
+const patternSignatureTokens = 3
+
+// PatternSignature is a stable key for the pattern of a message: its first
+// masked tokens, with tokens holding digits replaced by the wildcard. Unlike
+// the mined template it does not depend on which other rows were clustered
+// along with the message.
+func PatternSignature(msg string) string {
+	tokens := strings.Fields(maskTokens(msg))
+	if len(tokens) > patternSignatureTokens {
+		tokens = tokens[:patternSignatureTokens]
+	}
+	for i, t := range tokens {
+		if strings.ContainsAny(t, "0123456789") {
+			tokens[i] = patternWildcard
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// MinePatterns clusters normalized rows into message templates
+func MinePatterns(rows []map[string]interface{}) []*LogPattern {
+	pm := NewPatternMiner()
+	for _, row := range rows {
+		pm.Add(row)
+	}
+	return pm.Patterns()
+}
+
+// Patterns runs the query and mines message templates from its rows
+func (s *LogService) Patterns(ctx context.Context, engine, datasourceID string, req QueryRequest) ([]*LogPattern, int, error) {
+	result, err := s.ExecuteQuery(ctx, engine, datasourceID, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	return MinePatterns(result.Items), len(result.Items), nil
+}
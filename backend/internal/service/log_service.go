@@ -3,17 +3,9 @@ package service
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
-	"strconv"
-	"strings"
 	"time"
-
-	"ailap-backend/internal/database"
-	"ailap-backend/internal/model"
 )
 
 type LogService struct{}
@@ -25,333 +17,121 @@ func NewLogService() *LogService {
 // QueryResult represents a unified log entry structure
 type QueryResult struct {
 	Items []map[string]interface{} `json:"items"`
-}
-
-// NormalizeEntry ensures common fields exist
-func (s *LogService) NormalizeEntry(entry map[string]interface{}) map[string]interface{} {
-	// Standardize timestamp, message, level if possible
-	return entry
+	// NextCursor fetches the following page when set; empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+	// ResultType is "matrix" for metric queries, whose samples are in Series
+	ResultType string       `json:"resultType,omitempty"`
+	Series     []TimeSeries `json:"series,omitempty"`
 }
 
 // ExecuteQuery runs a query against the specified datasource and engine
-func (s *LogService) ExecuteQuery(ctx context.Context, engine, datasourceID, query, start, end string, limit int) (*QueryResult, error) {
-	if engine == "loki" {
-		return s.queryLoki(datasourceID, query, start, end, limit)
-	}
-	if engine == "elasticsearch" {
-		return s.queryElasticsearch(datasourceID, query, start, end, limit)
-	}
-	if engine == "victorialogs" {
-		return s.queryVictoriaLogs(datasourceID, query, start, end, limit)
-	}
-	return nil, fmt.Errorf("unsupported engine: %s", engine)
-}
-
-func (s *LogService) queryLoki(datasourceID, query, start, end string, limit int) (*QueryResult, error) {
-	_, cfg, endpoint, ok := ResolveLokiDatasource(datasourceID)
-	if !ok {
-		return nil, fmt.Errorf("datasource not found")
+func (s *LogService) ExecuteQuery(ctx context.Context, engine, datasourceID string, req QueryRequest) (*QueryResult, error) {
+	e, ds, err := s.resolve(engine, datasourceID)
+	if err != nil {
+		return nil, err
 	}
-
-	params := url.Values{}
-	params.Set("query", query)
-	params.Set("start", start)
-	params.Set("end", end)
-	params.Set("limit", strconv.Itoa(limit))
-	params.Set("direction", "BACKWARD") // default for monitoring usually latest
-
-	reqURL := endpoint
-	if parsed, err := url.Parse(reqURL); err == nil && (parsed.Path == "" || parsed.Path == "/") {
-		reqURL = reqURL + "/loki/api/v1/query_range?" + params.Encode()
-	} else {
-		if !strings.Contains(reqURL, "?") {
-			reqURL = reqURL + "?" + params.Encode()
-		}
+	if req, err = applyFilter(e, ds, req); err != nil {
+		return nil, err
 	}
-
-	req, _ := http.NewRequest(http.MethodGet, reqURL, nil)
-	ApplyAuthHeaders(req, cfg)
-	client := CreateHTTPClient(cfg, 60*time.Second)
-	resp, err := client.Do(req)
+	result, err := e.Query(ctx, ds, req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("loki error: %s", string(body))
+	if result.ResultType == "" {
+		s.NormalizeRows(result.Items, FieldMappingFromConfig(ds.Config))
 	}
-
-	items := FlattenLokiToRows(body)
-	return &QueryResult{Items: items}, nil
+	return result, nil
 }
 
-func (s *LogService) queryVictoriaLogs(datasourceID, query, start, end string, limit int) (*QueryResult, error) {
-	_, cfg, endpoint, ok := ResolveVictoriaLogsDatasource(datasourceID)
-	if !ok {
-		return nil, fmt.Errorf("datasource not found")
-	}
-
-	params := url.Values{}
-	if query == "" {
-		query = "*"
-	}
-	params.Set("query", query)
-	if start != "" {
-		params.Set("start", start)
+// Tail streams new entries of the query until ctx is cancelled or emit fails
+func (s *LogService) Tail(ctx context.Context, engine, datasourceID string, req QueryRequest, emit func(rows []map[string]interface{}) error) error {
+	e, ds, err := s.resolve(engine, datasourceID)
+	if err != nil {
+		return err
 	}
-	if end != "" {
-		params.Set("end", end)
+	if req, err = applyFilter(e, ds, req); err != nil {
+		return err
 	}
-	params.Set("limit", strconv.Itoa(limit))
-
-	reqURL := endpoint
-	if parsed, err := url.Parse(reqURL); err == nil && (parsed.Path == "" || parsed.Path == "/") {
-		reqURL = reqURL + "/select/logsql/query?" + params.Encode()
-	} else {
-		if !strings.Contains(reqURL, "?") {
-			reqURL = reqURL + "?" + params.Encode()
-		}
+	tailer, ok := e.(LogTailer)
+	if !ok {
+		return fmt.Errorf("engine %s does not support live tail", engine)
 	}
+	mapping := FieldMappingFromConfig(ds.Config)
+	return tailer.Tail(ctx, ds, req, func(rows []map[string]interface{}) error {
+		s.NormalizeRows(rows, mapping)
+		return emit(rows)
+	})
+}
 
-	req, _ := http.NewRequest(http.MethodGet, reqURL, nil)
-	ApplyAuthHeaders(req, cfg)
-	client := CreateHTTPClient(cfg, 60*time.Second)
-	resp, err := client.Do(req)
+// Labels lists label / field names of the datasource
+func (s *LogService) Labels(ctx context.Context, engine, datasourceID string) ([]string, error) {
+	e, ds, err := s.resolve(engine, datasourceID)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("victorialogs error: %s", string(body))
-	}
-
-	// Parse JSONL
-	items := make([]map[string]interface{}, 0)
-	lines := strings.Split(string(body), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-		var entry map[string]interface{}
-		if err := json.Unmarshal([]byte(line), &entry); err == nil {
-			row := make(map[string]interface{})
-			row["__raw"] = entry
-			if t, ok := entry["_time"].(string); ok {
-				row["timestamp"] = t
-			}
-			if msg, ok := entry["_msg"].(string); ok {
-				row["message"] = msg
-			} else {
-				row["message"] = line
-			}
-			for k, v := range entry {
-				if k != "_time" && k != "_msg" {
-					row[k] = v
-				}
-			}
-			items = append(items, row)
-		}
-	}
-	return &QueryResult{Items: items}, nil
+	return e.Labels(ctx, ds)
 }
 
-func (s *LogService) queryElasticsearch(datasourceID, query, start, end string, limit int) (*QueryResult, error) {
-	_, cfg, endpoint, ok := ResolveElasticsearchDatasource(datasourceID)
-	if !ok {
-		return nil, fmt.Errorf("datasource not found")
-	}
-
-	// Helper to resolve config fields
-	getString := func(m map[string]interface{}, key string) string {
-		if v, ok := m[key].(string); ok {
-			return v
-		}
-		return ""
-	}
-
-	timeField := "@timestamp"
-	messageField := "_source"
-	levelField := ""
-	indexPath := ""
-	xpack := false
-
-	if es, ok := cfg["es"].(map[string]interface{}); ok {
-		if v := getString(es, "timeField"); v != "" {
-			timeField = v
-		}
-		if v := getString(es, "index"); v != "" {
-			indexPath = "/" + v
-		}
-		if v, ok := es["xpack"].(bool); ok {
-			xpack = v
-		}
-	}
-	if logsCfg, ok := cfg["logs"].(map[string]interface{}); ok {
-		if v := getString(logsCfg, "messageField"); v != "" {
-			messageField = v
-		}
-		if v := getString(logsCfg, "levelField"); v != "" {
-			levelField = v
-		}
-	}
-
-	// Convert ns string to ms int64
-	nsToMs := func(s string, def int64) int64 {
-		if s == "" {
-			return def
-		}
-		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
-			return v / 1e6
-		}
-		return def
-	}
-	nowMs := time.Now().UnixMilli()
-	startMs := nsToMs(start, nowMs-3600*1000)
-	endMs := nsToMs(end, nowMs)
-
-	if query == "" {
-		query = "*"
-	}
-
-	mustConditions := []interface{}{}
-	if query == "*" {
-		mustConditions = append(mustConditions, map[string]interface{}{"match_all": map[string]interface{}{}})
-	} else {
-		mustConditions = append(mustConditions, map[string]interface{}{"query_string": map[string]interface{}{"query": query}})
-	}
-	mustConditions = append(mustConditions, map[string]interface{}{"range": map[string]interface{}{timeField: map[string]interface{}{"gte": startMs, "lte": endMs, "format": "epoch_millis"}}})
-
-	bodyJSON := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": mustConditions,
-			},
-		},
-		"sort": []interface{}{map[string]interface{}{timeField: map[string]interface{}{"order": "desc"}}},
-		"size": limit,
-	}
-
-	payload, _ := json.Marshal(bodyJSON)
-	searchURL := endpoint + indexPath + "/_search"
-	req, _ := http.NewRequest(http.MethodPost, searchURL, strings.NewReader(string(payload)))
-	req.Header.Set("Content-Type", "application/json")
-	if xpack {
-		req.Header.Set("X-Elastic-Product", "Elasticsearch")
+// LabelValues lists values of a label / field of the datasource
+func (s *LogService) LabelValues(ctx context.Context, engine, datasourceID, label string) ([]string, error) {
+	e, ds, err := s.resolve(engine, datasourceID)
+	if err != nil {
+		return nil, err
 	}
+	return e.LabelValues(ctx, ds, label)
+}
 
-	ApplyAuthHeaders(req, cfg)
-	client := CreateHTTPClient(cfg, 60*time.Second)
-	resp, err := client.Do(req)
+// Inspect returns the raw request the engine would send for the query
+func (s *LogService) Inspect(engine, datasourceID string, req QueryRequest) (*InspectResult, error) {
+	e, ds, err := s.resolve(engine, datasourceID)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("elasticsearch error: %s", string(body))
+	if req, err = applyFilter(e, ds, req); err != nil {
+		return nil, err
 	}
-
-	items := FlattenElasticsearchToRows(body, timeField, messageField, levelField)
-	return &QueryResult{Items: items}, nil
+	return e.Inspect(ds, req)
 }
 
-// Helpers moved from handler/logs.go and exported
-// Note: In a real refactor, these should be in a shared utils or config package,
-// but for now I'll duplicate/move them here or make the handler use this service.
-// To avoid cyclical imports, I'll copy the logic here.
-
-func ResolveLokiDatasource(id string) (ds model.DataSource, cfg map[string]interface{}, endpoint string, ok bool) {
-	// ... logic copied from handler ...
-	if id != "" {
-		if err := database.GetDB().First(&ds, "id = ?", id).Error; err == nil {
-			_ = json.Unmarshal([]byte(ds.Config), &cfg)
-			endpoint = ds.Endpoint
-			if endpoint == "" && cfg != nil {
-				if v, o := cfg["endpoint"].(string); o {
-					endpoint = v
-				}
-			}
-			return ds, cfg, endpoint, true
-		}
+// EffectiveQuery returns what the engine runs for req once the filter is
+// compiled: the LogQL / LogsQL query, or the search body for Elasticsearch
+func (s *LogService) EffectiveQuery(engine, datasourceID string, req QueryRequest) (string, error) {
+	e, ds, err := s.resolve(engine, datasourceID)
+	if err != nil {
+		return "", err
 	}
-	var items []model.DataSource
-	database.GetDB().Where("type = ?", "loki").Find(&items)
-	if len(items) == 0 {
-		return ds, nil, "", false
+	if req, err = applyFilter(e, ds, req); err != nil {
+		return "", err
 	}
-	// Simple pick first logic for service
-	ds = items[0]
-	_ = json.Unmarshal([]byte(ds.Config), &cfg)
-	endpoint = ds.Endpoint
-	if endpoint == "" && cfg != nil {
-		if v, o := cfg["endpoint"].(string); o {
-			endpoint = v
-		}
+	if req.Filter == nil {
+		return req.Query, nil
 	}
-	return ds, cfg, endpoint, true
+	r, err := e.Inspect(ds, req)
+	if err != nil {
+		return "", err
+	}
+	return r.Body, nil
 }
 
-func ResolveVictoriaLogsDatasource(id string) (ds model.DataSource, cfg map[string]interface{}, endpoint string, ok bool) {
-	if id != "" {
-		if err := database.GetDB().First(&ds, "id = ?", id).Error; err == nil {
-			_ = json.Unmarshal([]byte(ds.Config), &cfg)
-			endpoint = ds.Endpoint
-			if endpoint == "" && cfg != nil {
-				if v, o := cfg["endpoint"].(string); o {
-					endpoint = v
-				}
-			}
-			return ds, cfg, endpoint, true
-		}
-	}
-	var items []model.DataSource
-	database.GetDB().Where("type = ?", "victorialogs").Find(&items)
-	if len(items) == 0 {
-		return ds, nil, "", false
+// TestConnection probes an unsaved or stored datasource. Types without a
+// registered engine are probed with a plain GET on the endpoint.
+func (s *LogService) TestConnection(ctx context.Context, ds *Datasource) (*ConnectionResult, error) {
+	if e, ok := GetEngine(ds.Model.Type); ok {
+		return e.TestConnection(ctx, ds)
 	}
-	ds = items[0]
-	_ = json.Unmarshal([]byte(ds.Config), &cfg)
-	endpoint = ds.Endpoint
-	if endpoint == "" && cfg != nil {
-		if v, o := cfg["endpoint"].(string); o {
-			endpoint = v
-		}
-	}
-	return ds, cfg, endpoint, true
+	return probeEndpoint(ctx, ds, ds.Endpoint)
 }
 
-func ResolveElasticsearchDatasource(id string) (ds model.DataSource, cfg map[string]interface{}, endpoint string, ok bool) {
-	if id != "" {
-		if err := database.GetDB().First(&ds, "id = ?", id).Error; err == nil {
-			_ = json.Unmarshal([]byte(ds.Config), &cfg)
-			endpoint = ds.Endpoint
-			if endpoint == "" && cfg != nil {
-				if v, o := cfg["endpoint"].(string); o {
-					endpoint = v
-				}
-			}
-			return ds, cfg, endpoint, true
-		}
-	}
-	var items []model.DataSource
-	database.GetDB().Where("type = ?", "elasticsearch").Find(&items)
-	if len(items) == 0 {
-		return ds, nil, "", false
+func (s *LogService) resolve(engine, datasourceID string) (LogEngine, *Datasource, error) {
+	e, ok := GetEngine(engine)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported engine: %s", engine)
 	}
-	ds = items[0]
-	_ = json.Unmarshal([]byte(ds.Config), &cfg)
-	endpoint = ds.Endpoint
-	if endpoint == "" && cfg != nil {
-		if v, o := cfg["endpoint"].(string); o {
-			endpoint = v
-		}
+	ds, ok := ResolveDatasource(engine, datasourceID)
+	if !ok {
+		return nil, nil, fmt.Errorf("no %s datasource", engine)
 	}
-	return ds, cfg, endpoint, true
+	return e, ds, nil
 }
 
 func CreateHTTPClient(cfg map[string]interface{}, timeout time.Duration) *http.Client {
@@ -368,8 +148,6 @@ func CreateHTTPClient(cfg map[string]interface{}, timeout time.Duration) *http.C
 	}
 }
 
-// Import fix removed
-
 func ApplyAuthHeaders(req *http.Request, cfg map[string]interface{}) {
 	// Basic Auth
 	// Headers
@@ -396,69 +174,3 @@ func ApplyAuthHeaders(req *http.Request, cfg map[string]interface{}) {
 	}
 	// Token?
 }
-
-// Flatten functions
-func FlattenLokiToRows(body []byte) []map[string]interface{} {
-	// simplified version of handler logic
-	var resp struct {
-		Data struct {
-			Result []struct {
-				Stream map[string]string `json:"stream"`
-				Values [][]string        `json:"values"`
-			} `json:"result"`
-		} `json:"data"`
-	}
-	_ = json.Unmarshal(body, &resp)
-	items := make([]map[string]interface{}, 0)
-	for _, series := range resp.Data.Result {
-		for _, val := range series.Values {
-			if len(val) < 2 {
-				continue
-			}
-			row := make(map[string]interface{})
-			row["timestamp"] = val[0]
-			row["message"] = val[1]
-			for k, v := range series.Stream {
-				row[k] = v
-			}
-			items = append(items, row)
-		}
-	}
-	return items
-}
-
-func FlattenElasticsearchToRows(body []byte, timeField, msgField, lvlField string) []map[string]interface{} {
-	var resp struct {
-		Hits struct {
-			Hits []struct {
-				Source map[string]interface{} `json:"_source"`
-			} `json:"hits"`
-		} `json:"hits"`
-	}
-	_ = json.Unmarshal(body, &resp)
-	items := make([]map[string]interface{}, 0)
-	for _, hit := range resp.Hits.Hits {
-		src := hit.Source
-		row := make(map[string]interface{})
-		row["__raw"] = src
-
-		if t, ok := src[timeField]; ok {
-			row["timestamp"] = fmt.Sprintf("%v", t)
-		}
-		if msgField == "_source" {
-			b, _ := json.Marshal(src)
-			row["message"] = string(b)
-		} else {
-			if m, ok := src[msgField]; ok {
-				row["message"] = fmt.Sprintf("%v", m)
-			}
-		}
-		if lvlField != "" {
-			if l, ok := src[lvlField]; ok {
-				row["level"] = fmt.Sprintf("%v", l)
-			}
-		}
-		items = append(items, row)
-	}
-	return items
-}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeSeries is one labelled series of a metric query or volume histogram
+type TimeSeries struct {
+	Labels map[string]string `json:"labels"`
+	Points []SeriesPoint     `json:"points"`
+}
+
+// SeriesPoint is a single sample; Timestamp is unix millis
+type SeriesPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// VolumeResult holds log counts bucketed by time, one series per level
+type VolumeResult struct {
+	Step   int64        `json:"step"` // bucket size in seconds
+	Series []TimeSeries `json:"series"`
+}
+
+// LogVolumer is implemented by engines that can count matching entries per
+// time bucket and level, backing the histogram above the log list.
+type LogVolumer interface {
+	Volume(ctx context.Context, ds *Datasource, req QueryRequest, step time.Duration) (*VolumeResult, error)
+}
+
+// volumeBuckets is the target number of histogram bars when no step is given
+const volumeBuckets = 100
+
+// Volume returns bucketed counts per level for the query and time range
+func (s *LogService) Volume(ctx context.Context, engine, datasourceID string, req QueryRequest) (*VolumeResult, error) {
+	e, ds, err := s.resolve(engine, datasourceID)
+	if err != nil {
+		return nil, err
+	}
+	if req, err = applyFilter(e, ds, req); err != nil {
+		return nil, err
+	}
+	volumer, ok := e.(LogVolumer)
+	if !ok {
+		return nil, fmt.Errorf("engine %s does not support log volume", engine)
+	}
+	req.Start, req.End = defaultTimeRange(req.Start, req.End)
+	return volumer.Volume(ctx, ds, req, volumeStep(req))
+}
+
+// defaultTimeRange fills missing ns bounds with the last hour
+func defaultTimeRange(start, end string) (string, string) {
+	now := time.Now()
+	if end == "" {
+		end = strconv.FormatInt(now.UnixNano(), 10)
+	}
+	if start == "" {
+		start = strconv.FormatInt(now.Add(-1*time.Hour).UnixNano(), 10)
+	}
+	return start, end
+}
+
+// volumeStep parses req.Step ("60s", "5m" or plain seconds) or derives a step
+// giving roughly volumeBuckets buckets over the time range.
+func volumeStep(req QueryRequest) time.Duration {
+	if req.Step != "" {
+		if d, err := time.ParseDuration(req.Step); err == nil && d >= time.Second {
+			return d.Truncate(time.Second)
+		}
+		if secs, err := strconv.Atoi(req.Step); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	startNs, _ := strconv.ParseInt(req.Start, 10, 64)
+	endNs, _ := strconv.ParseInt(req.End, 10, 64)
+	step := time.Duration(endNs-startNs) / volumeBuckets
+	if step < time.Second {
+		return time.Second
+	}
+	return step.Truncate(time.Second)
+}
+
+// formatStep renders a step as whole seconds, e.g. "60s"
+func formatStep(step time.Duration) string {
+	return strconv.FormatInt(int64(step/time.Second), 10) + "s"
+}
+
+// normalizeVolumeLevel maps empty level labels to "unknown" and lowercases the rest
+func normalizeVolumeLevel(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if level == "" {
+		return "unknown"
+	}
+	return level
+}
+
+// volumeCollector accumulates counts into one series per level
+type volumeCollector struct {
+	order  []string
+	counts map[string]map[int64]float64
+}
+
+func newVolumeCollector() *volumeCollector {
+	return &volumeCollector{counts: map[string]map[int64]float64{}}
+}
+
+func (v *volumeCollector) add(level string, tsMs int64, count float64) {
+	level = normalizeVolumeLevel(level)
+	buckets, ok := v.counts[level]
+	if !ok {
+		buckets = map[int64]float64{}
+		v.counts[level] = buckets
+		v.order = append(v.order, level)
+	}
+	buckets[tsMs] += count
+}
+
+func (v *volumeCollector) result(step time.Duration) *VolumeResult {
+	out := &VolumeResult{Step: int64(step / time.Second), Series: make([]TimeSeries, 0, len(v.order))}
+	for _, level := range v.order {
+		points := make([]SeriesPoint, 0, len(v.counts[level]))
+		for ts, count := range v.counts[level] {
+			points = append(points, SeriesPoint{Timestamp: ts, Value: count})
+		}
+		sort.Slice(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+		out.Series = append(out.Series, TimeSeries{Labels: map[string]string{"level": level}, Points: points})
+	}
+	return out
+}
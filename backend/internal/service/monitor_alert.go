@@ -0,0 +1,398 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+)
+
+// Alert statuses: firing -> acknowledged (optional) -> resolved
+const (
+	AlertFiring       = "firing"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+const (
+	// defaultRenotifyInterval is how often a firing alert is repeated when the
+	// monitor does not set RenotifyInterval
+	defaultRenotifyInterval = 4 * time.Hour
+	// alertResolveRuns is the number of evaluated runs in a row without a
+	// match after which an alert resolves, so a bursty error does not flap
+	alertResolveRuns = 2
+	// maxPatternAlerts caps the alerts a monitor without conditions raises
+	// per run, one per log pattern, most frequent first
+	maxPatternAlerts = 10
+)
+
+// ErrAlertState is returned for a state change the alert's status does not allow
+var ErrAlertState = fmt.Errorf("alert cannot change to that state")
+
+// alertInstance is one thing a run found worth alerting on, before it is
+// matched against the open alerts of the monitor
+type alertInstance struct {
+	fingerprint string
+	labels      map[string]string
+	// annotations describe the alert without identifying it, e.g. the mined
+	// pattern text, which changes with the rows of each run
+	annotations map[string]string
+	severity    string
+	summary     string
+}
+
+func newAlertInstance(labels map[string]string, severity, summary string) alertInstance {
+	return alertInstance{fingerprint: alertFingerprint(labels), labels: labels, severity: severity, summary: summary}
+}
+
+// alertFingerprint hashes the sorted labels, identifying "the same alert" across runs
+func alertFingerprint(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k + "=" + labels[k] + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// conditionAlerts raises one alert per fired condition and group
+func conditionAlerts(m *model.LogMonitor, fired []ConditionResult) []alertInstance {
+	out := make([]alertInstance, 0, len(fired))
+	for _, r := range fired {
+		labels := map[string]string{
+			"monitor":   m.Name,
+			"monitorId": strconv.FormatUint(uint64(m.ID), 10),
+			"condition": r.Type,
+			"rule":      strconv.Itoa(r.Index + 1),
+		}
+		if r.GroupBy != "" {
+			labels[r.GroupBy] = r.Group
+		}
+		out = append(out, newAlertInstance(labels, r.Severity, conditionsText([]ConditionResult{r})))
+	}
+	return out
+}
+
+// patternAlerts raises one alert per message pattern of the matched rows.
+// The mined template depends on which rows fell into the window, so alerts
+// are keyed by the dominant level and the pattern signature instead, and the
+// template is only kept as an annotation. Patterns sharing a key are merged
+// into the alert of the most frequent one.
+func patternAlerts(m *model.LogMonitor, rows []map[string]interface{}) []alertInstance {
+	var out []alertInstance
+	counts := map[string]int{}
+	index := map[string]int{}
+	for _, p := range MinePatterns(rows) {
+		signature := ""
+		if len(p.Samples) > 0 {
+			signature = PatternSignature(stringValue(p.Samples[0]["message"]))
+		}
+		labels := map[string]string{
+			"monitor":   m.Name,
+			"monitorId": strconv.FormatUint(uint64(m.ID), 10),
+			"level":     dominantLevel(p.Levels),
+			"signature": signature,
+		}
+		in := newAlertInstance(labels, "", "")
+		counts[in.fingerprint] += p.Count
+		if i, ok := index[in.fingerprint]; ok {
+			out[i].summary = fmt.Sprintf("%d x %s", counts[in.fingerprint], out[i].annotations["pattern"])
+			continue
+		}
+		if len(out) >= maxPatternAlerts {
+			continue
+		}
+		in.annotations = map[string]string{"pattern": p.Pattern}
+		in.summary = fmt.Sprintf("%d x %s", p.Count, p.Pattern)
+		index[in.fingerprint] = len(out)
+		out = append(out, in)
+	}
+	return out
+}
+
+// dominantLevel is the most frequent level of a pattern, "" when unknown
+func dominantLevel(levels map[string]int) string {
+	best := ""
+	for level, n := range levels {
+		if best == "" || n > levels[best] || (n == levels[best] && level < best) {
+			best = level
+		}
+	}
+	return best
+}
+
+// renotifyInterval is the monitor's RenotifyInterval or the default
+func renotifyInterval(m *model.LogMonitor) time.Duration {
+	if d, err := time.ParseDuration(m.RenotifyInterval); err == nil && d > 0 {
+		return d
+	}
+	return defaultRenotifyInterval
+}
+
+// ValidateRenotifyInterval checks an optional interval such as "30m" or "4h"
+func ValidateRenotifyInterval(interval string) error {
+	if interval == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(interval); err != nil || d < time.Minute {
+		return fmt.Errorf("renotify interval must be a duration of at least 1m")
+	}
+	return nil
+}
+
+// updateAlerts matches the instances of an evaluated run against the open
+// alerts of the monitor. New fingerprints open a firing alert, known ones
+// are refreshed, and open alerts that stopped matching resolve after
+// alertResolveRuns runs. It returns the firing alerts due for a notification
+// (new, or last sent more than the re-notify interval ago, and not silenced)
+// and the alerts that resolved after having been notified.
+func (s *MonitorService) updateAlerts(m *model.LogMonitor, run *model.MonitorRun, instances []alertInstance, now time.Time) (notify, resolved []model.Alert) {
+	db := database.GetDB()
+	var open []model.Alert
+	db.Where("monitor_id = ? AND status <> ?", m.ID, AlertResolved).Find(&open)
+	byFingerprint := map[string]*model.Alert{}
+	for i := range open {
+		byFingerprint[open[i].Fingerprint] = &open[i]
+	}
+	silences := activeSilences(now)
+	renotify := renotifyInterval(m)
+
+	seen := map[string]bool{}
+	for _, in := range instances {
+		if seen[in.fingerprint] {
+			continue
+		}
+		seen[in.fingerprint] = true
+		a, ok := byFingerprint[in.fingerprint]
+		if !ok {
+			a = &model.Alert{MonitorID: m.ID, Fingerprint: in.fingerprint, Status: AlertFiring, StartsAt: now}
+		}
+		labels, _ := json.Marshal(in.labels)
+		a.Labels, a.Summary = string(labels), in.summary
+		a.Annotations = ""
+		if len(in.annotations) > 0 {
+			annotations, _ := json.Marshal(in.annotations)
+			a.Annotations = string(annotations)
+		}
+		if in.severity != "" {
+			// Pattern alerts keep the severity their analysis gave them
+			a.Severity = in.severity
+		}
+		a.LastSeenAt, a.MissedRuns, a.RunID = now, 0, run.ID
+		a.SilenceID = matchSilence(silences, m.ID, in.labels)
+		db.Save(a)
+		if a.Status == AlertFiring && a.SilenceID == 0 && (a.LastNotifiedAt == nil || now.Sub(*a.LastNotifiedAt) >= renotify) {
+			notify = append(notify, *a)
+		}
+	}
+
+	for i := range open {
+		a := &open[i]
+		if seen[a.Fingerprint] {
+			continue
+		}
+		a.MissedRuns++
+		if a.MissedRuns >= alertResolveRuns {
+			a.Status, a.ResolvedAt = AlertResolved, &now
+			var labels map[string]string
+			_ = json.Unmarshal([]byte(a.Labels), &labels)
+			if a.NotifyCount > 0 && matchSilence(silences, m.ID, labels) == 0 {
+				resolved = append(resolved, *a)
+			}
+		}
+		db.Save(a)
+	}
+	return notify, resolved
+}
+
+// markNotified records that the alerts were sent
+func markNotified(alerts []model.Alert, now time.Time) {
+	if len(alerts) == 0 {
+		return
+	}
+	ids := make([]uint, len(alerts))
+	for i, a := range alerts {
+		ids[i] = a.ID
+	}
+	database.GetDB().Model(&model.Alert{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"last_notified_at":  now,
+		"first_notified_at": gorm.Expr("COALESCE(first_notified_at, ?)", now),
+		"notify_count":      gorm.Expr("notify_count + 1"),
+	})
+}
+
+// highestSeverity is the most severe severity of the alerts
+func highestSeverity(alerts []model.Alert) string {
+	best := ""
+	for _, a := range alerts {
+		if r := severityRank(a.Severity); r >= 0 && (best == "" || r < severityRank(best)) {
+			best = a.Severity
+		}
+	}
+	return best
+}
+
+// alertsText renders alerts as notification lines, most severe first
+func alertsText(alerts []model.Alert, now time.Time) string {
+	sorted := append([]model.Alert(nil), alerts...)
+	sort.SliceStable(sorted, func(i, j int) bool { return severityRank(sorted[i].Severity) < severityRank(sorted[j].Severity) })
+	var b strings.Builder
+	for _, a := range sorted {
+		line := strings.TrimPrefix(strings.TrimSpace(a.Summary), "- ")
+		state := "new"
+		switch {
+		case a.Status == AlertResolved && a.ResolvedAt != nil:
+			state = "lasted " + a.ResolvedAt.Sub(a.StartsAt).Round(time.Second).String()
+		case a.LastNotifiedAt != nil:
+			state = "firing for " + now.Sub(a.StartsAt).Round(time.Second).String()
+		}
+		b.WriteString(fmt.Sprintf("- %s (%s, alert #%d)\n", line, state, a.ID))
+	}
+	return b.String()
+}
+
+// SilenceMatcher matches one alert label. Regex values are anchored, so
+// "api|web" matches exactly those two values.
+type SilenceMatcher struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Regex bool   `json:"regex,omitempty"`
+}
+
+// parseSilenceMatchers decodes the matchers JSON of a silence
+func parseSilenceMatchers(raw string) ([]SilenceMatcher, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var matchers []SilenceMatcher
+	if err := json.Unmarshal([]byte(raw), &matchers); err != nil {
+		return nil, fmt.Errorf("invalid matchers: %v", err)
+	}
+	for i, mt := range matchers {
+		if strings.TrimSpace(mt.Name) == "" {
+			return nil, fmt.Errorf("matcher %d: name is required", i+1)
+		}
+		if mt.Regex {
+			if _, err := regexp.Compile("^(?:" + mt.Value + ")$"); err != nil {
+				return nil, fmt.Errorf("matcher %d: %v", i+1, err)
+			}
+		}
+	}
+	return matchers, nil
+}
+
+// ValidateSilence checks the matchers and time range of a silence, starting
+// it now when no start is given
+func ValidateSilence(sl *model.Silence) error {
+	if _, err := parseSilenceMatchers(sl.Matchers); err != nil {
+		return err
+	}
+	if sl.StartsAt.IsZero() {
+		sl.StartsAt = time.Now()
+	}
+	if !sl.EndsAt.After(sl.StartsAt) {
+		return fmt.Errorf("endsAt must be after startsAt")
+	}
+	return nil
+}
+
+// activeSilences returns the silences in effect at now
+func activeSilences(now time.Time) []model.Silence {
+	var items []model.Silence
+	database.GetDB().Where("starts_at <= ? AND ends_at > ?", now, now).Find(&items)
+	return items
+}
+
+// matchSilence returns the id of the first silence muting an alert of the
+// monitor with these labels, 0 when none does
+func matchSilence(silences []model.Silence, monitorID uint, labels map[string]string) uint {
+	for _, sl := range silences {
+		if sl.MonitorID != 0 && sl.MonitorID != monitorID {
+			continue
+		}
+		matchers, err := parseSilenceMatchers(sl.Matchers)
+		if err != nil {
+			continue
+		}
+		ok := true
+		for _, mt := range matchers {
+			v := labels[mt.Name]
+			if mt.Regex {
+				re, _ := regexp.Compile("^(?:" + mt.Value + ")$")
+				ok = re.MatchString(v)
+			} else {
+				ok = v == mt.Value
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return sl.ID
+		}
+	}
+	return 0
+}
+
+// ListAlerts returns the latest alerts, optionally of one status or monitor
+func (s *MonitorService) ListAlerts(status string, monitorID uint, limit int) ([]model.Alert, error) {
+	q := database.GetDB().Order("id desc").Limit(chooseInt(limit, 100))
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if monitorID != 0 {
+		q = q.Where("monitor_id = ?", monitorID)
+	}
+	var items []model.Alert
+	err := q.Find(&items).Error
+	return items, err
+}
+
+// AcknowledgeAlert moves a firing alert to acknowledged, which stops its
+// repeat notifications; it still resolves (and says so) on its own
+func (s *MonitorService) AcknowledgeAlert(id, userID uint) (*model.Alert, error) {
+	var a model.Alert
+	if err := database.GetDB().First(&a, id).Error; err != nil {
+		return nil, err
+	}
+	if a.Status != AlertFiring {
+		return nil, ErrAlertState
+	}
+	now := time.Now()
+	a.Status, a.AckedBy, a.AckedAt = AlertAcknowledged, userID, &now
+	if err := database.GetDB().Save(&a).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListSilences returns the silences, the active and pending ones only unless all is set
+func (s *MonitorService) ListSilences(all bool) ([]model.Silence, error) {
+	q := database.GetDB().Order("id desc")
+	if !all {
+		q = q.Where("ends_at > ?", time.Now())
+	}
+	var items []model.Silence
+	err := q.Find(&items).Error
+	return items, err
+}
+
+// ExpireSilence ends a silence now, keeping it for the record
+func (s *MonitorService) ExpireSilence(id uint) error {
+	now := time.Now()
+	return database.GetDB().Model(&model.Silence{}).Where("id = ? AND ends_at > ?", id, now).Update("ends_at", now).Error
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"ailap-backend/internal/database"
+	"ailap-backend/internal/model"
+	"ailap-backend/internal/utils"
+)
+
+// maxEscalateAfter caps the escalation delay of a route, in minutes (one week)
+const maxEscalateAfter = 7 * 24 * 60
+
+// escalationSchedule is how often unacknowledged alerts are checked for escalation
+const escalationSchedule = "@every 1m"
+
+// ValidateRoutes checks the channels, severities and escalation delays of monitor routes
+func ValidateRoutes(routes []model.MonitorRoute) error {
+	for i, r := range routes {
+		if r.ChannelID == 0 {
+			return fmt.Errorf("route %d: channel is required", i+1)
+		}
+		var channel model.NotificationChannel
+		if err := database.GetDB().First(&channel, r.ChannelID).Error; err != nil {
+			return fmt.Errorf("route %d: channel %d not found", i+1, r.ChannelID)
+		}
+		for _, sev := range routeSeverities(r) {
+			if severityRank(sev) < 0 {
+				return fmt.Errorf("route %d: unknown severity %q", i+1, sev)
+			}
+		}
+		if r.EscalateAfter < 0 || r.EscalateAfter > maxEscalateAfter {
+			return fmt.Errorf("route %d: escalate after must be between 0 and %d minutes", i+1, maxEscalateAfter)
+		}
+	}
+	return nil
+}
+
+// SaveMonitorRoutes replaces the routes of a monitor
+func SaveMonitorRoutes(monitorID uint, routes []model.MonitorRoute) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("monitor_id = ?", monitorID).Delete(&model.MonitorRoute{}).Error; err != nil {
+			return err
+		}
+		if len(routes) == 0 {
+			return nil
+		}
+		for i := range routes {
+			routes[i].ID, routes[i].MonitorID = 0, monitorID
+		}
+		return tx.Create(&routes).Error
+	})
+}
+
+// routeSeverities splits the comma separated severities of a route
+func routeSeverities(r model.MonitorRoute) []string {
+	var out []string
+	for _, s := range strings.Split(r.Severities, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// routeTakes reports whether the route takes alerts of the severity. Alerts
+// without a severity only go to routes without a severity filter.
+func routeTakes(r model.MonitorRoute, severity string) bool {
+	sevs := routeSeverities(r)
+	if len(sevs) == 0 {
+		return true
+	}
+	for _, s := range sevs {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// monitorRoutes returns the routes of the monitor, or a single route to its
+// ChannelID for monitors configured before routes existed
+func monitorRoutes(m *model.LogMonitor) []model.MonitorRoute {
+	var routes []model.MonitorRoute
+	database.GetDB().Where("monitor_id = ?", m.ID).Order("id").Find(&routes)
+	if len(routes) == 0 && m.ChannelID != 0 {
+		routes = []model.MonitorRoute{{MonitorID: m.ID, ChannelID: m.ChannelID}}
+	}
+	return routes
+}
+
+// routeAlerts groups the alerts by the channel of every route that takes
+// them, keeping the order of first use. Escalation routes only take alerts
+// that were already escalated, so they hear about repeats and resolution of
+// what they were escalated, never about new alerts.
+func routeAlerts(routes []model.MonitorRoute, alerts []model.Alert) ([]uint, map[uint][]model.Alert) {
+	var order []uint
+	byChannel := map[uint][]model.Alert{}
+	taken := map[uint]map[uint]bool{}
+	for _, r := range routes {
+		for _, a := range alerts {
+			if !routeTakes(r, a.Severity) || (r.EscalateAfter > 0 && a.EscalatedAt == nil) {
+				continue
+			}
+			if taken[r.ChannelID] == nil {
+				taken[r.ChannelID] = map[uint]bool{}
+				order = append(order, r.ChannelID)
+			}
+			if !taken[r.ChannelID][a.ID] {
+				taken[r.ChannelID][a.ID] = true
+				byChannel[r.ChannelID] = append(byChannel[r.ChannelID], a)
+			}
+		}
+	}
+	return order, byChannel
+}
+
+// deliver sends the alerts to the channels routed for them, rendering the
+// title and content per channel from the alerts it takes. It returns how many
+// channels got the message and the failures, if any.
+func (s *MonitorService) deliver(m *model.LogMonitor, alerts []model.Alert, render func(alerts []model.Alert) (string, string)) (int, error) {
+	channels, byChannel := routeAlerts(monitorRoutes(m), alerts)
+	if len(channels) == 0 {
+		return 0, fmt.Errorf("no channel is routed for these alerts")
+	}
+	sent := 0
+	var errs []string
+	for _, id := range channels {
+		title, content := render(byChannel[id])
+		if err := s.sendToChannel(id, title, content); err != nil {
+			errs = append(errs, fmt.Sprintf("channel %d: %v", id, err))
+			continue
+		}
+		sent++
+	}
+	if len(errs) > 0 {
+		return sent, errors.New(strings.Join(errs, "; "))
+	}
+	return sent, nil
+}
+
+// sendToChannel delivers one message on a notification channel
+func (s *MonitorService) sendToChannel(channelID uint, title, content string) error {
+	var channel model.NotificationChannel
+	if err := database.GetDB().First(&channel, channelID).Error; err != nil {
+		return fmt.Errorf("channel %d not found", channelID)
+	}
+	return s.notifyService.SendAlert(&channel, title, content)
+}
+
+// escalateAlerts sends firing alerts that nobody acknowledged in time to the
+// escalation routes of their monitor. An alert escalates on a route once the
+// route's delay since its first notification has passed, and each route
+// escalates it only once.
+func (s *MonitorService) escalateAlerts() {
+	now := time.Now()
+	var alerts []model.Alert
+	if err := database.GetDB().Where("status = ? AND first_notified_at IS NOT NULL AND silence_id = 0", AlertFiring).Find(&alerts).Error; err != nil || len(alerts) == 0 {
+		return
+	}
+	byMonitor := map[uint][]model.Alert{}
+	for _, a := range alerts {
+		byMonitor[a.MonitorID] = append(byMonitor[a.MonitorID], a)
+	}
+
+	for monitorID, list := range byMonitor {
+		var m model.LogMonitor
+		if err := database.GetDB().First(&m, monitorID).Error; err != nil {
+			continue
+		}
+		var order []uint
+		due := map[uint][]model.Alert{}
+		delay := map[uint]int{}
+		taken := map[uint]map[uint]bool{}
+		for _, r := range monitorRoutes(&m) {
+			if r.EscalateAfter <= 0 {
+				continue
+			}
+			for _, a := range list {
+				at := a.FirstNotifiedAt.Add(time.Duration(r.EscalateAfter) * time.Minute)
+				if now.Before(at) || (a.EscalatedAt != nil && !a.EscalatedAt.Before(at)) || !routeTakes(r, a.Severity) {
+					continue
+				}
+				if taken[r.ChannelID] == nil {
+					taken[r.ChannelID] = map[uint]bool{}
+					order = append(order, r.ChannelID)
+				}
+				if !taken[r.ChannelID][a.ID] {
+					taken[r.ChannelID][a.ID] = true
+					due[r.ChannelID] = append(due[r.ChannelID], a)
+					delay[r.ChannelID] = r.EscalateAfter
+				}
+			}
+		}
+
+		var escalated []uint
+		for _, id := range order {
+			title := fmt.Sprintf("Escalation: %s", m.Name)
+			if sev := highestSeverity(due[id]); sev != "" {
+				title = fmt.Sprintf("Escalation [%s]: %s", strings.ToUpper(sev), m.Name)
+			}
+			content := fmt.Sprintf("Monitor: %s\nTime: %s\nNot acknowledged within %d minutes:\n%s", m.Name, now.Format(time.RFC3339), delay[id], alertsText(due[id], now))
+			if err := s.sendToChannel(id, title, content); err != nil {
+				// Not marked, so the next sweep tries again
+				utils.GetLogger().Error("alert escalation failed", zap.Uint("id", m.ID), zap.Uint("channel_id", id), zap.Error(err))
+				continue
+			}
+			for _, a := range due[id] {
+				escalated = append(escalated, a.ID)
+			}
+		}
+		if len(escalated) > 0 {
+			database.GetDB().Model(&model.Alert{}).Where("id IN ?", escalated).Update("escalated_at", now)
+			utils.GetLogger().Info("alerts escalated", zap.Uint("id", m.ID), zap.Int("alerts", len(escalated)))
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Monitor condition types
+const (
+	ConditionCount   = "count"   // matches in the window exceed Threshold
+	ConditionChange  = "change"  // matches changed by Threshold percent or more vs the previous window
+	ConditionAbsence = "absence" // matches at or below Threshold, e.g. a missing heartbeat
+)
+
+// maxConditions caps the number of conditions of one monitor
+const maxConditions = 20
+
+// MonitorCondition is one alert rule of a monitor. With GroupBy the condition
+// is evaluated per value of a label / field, e.g. "more than 50 errors per
+// service". A monitor without conditions fires on any match.
+type MonitorCondition struct {
+	Type string `json:"type"`
+	// Threshold is a count for count / absence conditions and a percentage
+	// for change conditions; a negative change threshold watches for drops
+	Threshold float64 `json:"threshold"`
+	// MinCount is how many matches the busier of both windows needs before a
+	// change condition fires, so 1 -> 3 errors is not reported as a spike
+	MinCount float64 `json:"minCount,omitempty"`
+	GroupBy  string  `json:"groupBy,omitempty"`
+	Severity string  `json:"severity"`
+}
+
+// ConditionResult is the outcome of one condition for one group
+type ConditionResult struct {
+	Index    int     `json:"index"` // position in the monitor's conditions
+	Type     string  `json:"type"`
+	GroupBy  string  `json:"groupBy,omitempty"`
+	Group    string  `json:"group,omitempty"`
+	Value    float64 `json:"value"`              // matches in the window
+	Previous float64 `json:"previous,omitempty"` // matches in the previous window
+	Severity string  `json:"severity"`
+	Fired    bool    `json:"fired"`
+	Summary  string  `json:"summary"`
+}
+
+// ParseConditions decodes and validates the conditions JSON of a monitor on
+// engine. An empty string means no conditions; missing severities default to
+// medium.
+func ParseConditions(raw, engine string) ([]MonitorCondition, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var conds []MonitorCondition
+	if err := json.Unmarshal([]byte(raw), &conds); err != nil {
+		return nil, fmt.Errorf("invalid conditions: %v", err)
+	}
+	if len(conds) > maxConditions {
+		return nil, fmt.Errorf("at most %d conditions are allowed", maxConditions)
+	}
+	for i := range conds {
+		c := &conds[i]
+		c.GroupBy = strings.TrimSpace(c.GroupBy)
+		switch c.Type {
+		case ConditionCount, ConditionAbsence:
+			if c.Threshold < 0 {
+				return nil, fmt.Errorf("condition %d: threshold must not be negative", i+1)
+			}
+		case ConditionChange:
+			if c.Threshold == 0 {
+				return nil, fmt.Errorf("condition %d: change threshold must not be 0", i+1)
+			}
+		default:
+			return nil, fmt.Errorf("condition %d: unknown type %q", i+1, c.Type)
+		}
+		if c.GroupBy != "" {
+			if err := ValidateGroupBy(engine, c.GroupBy); err != nil {
+				return nil, fmt.Errorf("condition %d: %v", i+1, err)
+			}
+		}
+		if c.Severity == "" {
+			c.Severity = SeverityMedium
+		}
+		if severityRank(c.Severity) < 0 {
+			return nil, fmt.Errorf("condition %d: unknown severity %q", i+1, c.Severity)
+		}
+	}
+	return conds, nil
+}
+
+// severityRank orders severities, 0 being the most severe; -1 when unknown
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// evaluateConditions counts the matches of the current window, and of the
+// window before it when a condition compares against it, and evaluates every
+// condition. It returns the results worth keeping (every fired group plus the
+// closest group of a condition that did not fire) and the total of the window.
+func (s *MonitorService) evaluateConditions(ctx context.Context, engine, datasourceID string, conds []MonitorCondition, req QueryRequest) ([]ConditionResult, int, error) {
+	prevReq := req
+	startNs, _ := strconv.ParseInt(req.Start, 10, 64)
+	endNs, _ := strconv.ParseInt(req.End, 10, 64)
+	prevReq.Start, prevReq.End = strconv.FormatInt(startNs-(endNs-startNs), 10), req.Start
+
+	current := map[string]map[string]float64{}
+	previous := map[string]map[string]float64{}
+	count := func(cache map[string]map[string]float64, r QueryRequest, groupBy string) (map[string]float64, error) {
+		if counts, ok := cache[groupBy]; ok {
+			return counts, nil
+		}
+		cctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+		counts, err := s.logService.Count(cctx, engine, datasourceID, r, groupBy)
+		if err != nil {
+			return nil, err
+		}
+		cache[groupBy] = counts
+		return counts, nil
+	}
+
+	var out []ConditionResult
+	for i, c := range conds {
+		cur, err := count(current, req, c.GroupBy)
+		if err != nil {
+			return nil, 0, err
+		}
+		var prev map[string]float64
+		if c.Type == ConditionChange || (c.Type == ConditionAbsence && c.GroupBy != "") {
+			if prev, err = count(previous, prevReq, c.GroupBy); err != nil {
+				return nil, 0, err
+			}
+		}
+		out = append(out, evaluateCondition(i, c, cur, prev)...)
+	}
+
+	total := 0
+	for _, n := range current[conds[0].GroupBy] {
+		total += int(n)
+	}
+	return out, total, nil
+}
+
+// evaluateCondition evaluates one condition against the per group counts
+func evaluateCondition(index int, c MonitorCondition, cur, prev map[string]float64) []ConditionResult {
+	groups := map[string]bool{}
+	for g := range cur {
+		groups[g] = true
+	}
+	switch {
+	case c.GroupBy == "":
+		groups = map[string]bool{"": true}
+	case c.Type == ConditionAbsence || (c.Type == ConditionChange && c.Threshold < 0):
+		// Groups that went quiet only show up in the previous window
+		for g := range prev {
+			groups[g] = true
+		}
+	}
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+
+	var fired []ConditionResult
+	var closest *ConditionResult
+	closestGap := 0.0
+	for _, g := range names {
+		r := ConditionResult{Index: index, Type: c.Type, GroupBy: c.GroupBy, Group: g, Value: cur[g], Previous: prev[g], Severity: c.Severity}
+		var gap float64 // how far the group is from firing, lower is closer
+		switch c.Type {
+		case ConditionCount:
+			r.Fired = r.Value > c.Threshold
+			gap = c.Threshold - r.Value
+			r.Summary = fmt.Sprintf("%s matches (threshold > %s)", formatCount(r.Value), formatCount(c.Threshold))
+		case ConditionAbsence:
+			r.Fired = r.Value <= c.Threshold
+			gap = r.Value - c.Threshold
+			r.Summary = fmt.Sprintf("%s matches (expected more than %s)", formatCount(r.Value), formatCount(c.Threshold))
+		case ConditionChange:
+			busiest := r.Value
+			if r.Previous > busiest {
+				busiest = r.Previous
+			}
+			if r.Previous == 0 {
+				// No baseline: a new burst counts as an increase, never as a drop
+				r.Fired = c.Threshold > 0 && r.Value > 0 && busiest >= c.MinCount
+				gap = -r.Value
+				r.Summary = fmt.Sprintf("%s matches, none in the previous window (threshold %+g%%)", formatCount(r.Value), c.Threshold)
+				break
+			}
+			change := (r.Value - r.Previous) / r.Previous * 100
+			if c.Threshold > 0 {
+				r.Fired = change >= c.Threshold
+				gap = c.Threshold - change
+			} else {
+				r.Fired = change <= c.Threshold
+				gap = change - c.Threshold
+			}
+			r.Fired = r.Fired && busiest >= c.MinCount
+			r.Summary = fmt.Sprintf("%s -> %s matches, %+.0f%% (threshold %+g%%)", formatCount(r.Previous), formatCount(r.Value), change, c.Threshold)
+		}
+		if r.Fired {
+			fired = append(fired, r)
+		} else if closest == nil || gap < closestGap {
+			rc := r
+			closest, closestGap = &rc, gap
+		}
+	}
+	if len(fired) > 0 {
+		return fired
+	}
+	if closest != nil {
+		return []ConditionResult{*closest}
+	}
+	return nil
+}
+
+// firedConditions returns the fired results, most severe first
+func firedConditions(results []ConditionResult) []ConditionResult {
+	var fired []ConditionResult
+	for _, r := range results {
+		if r.Fired {
+			fired = append(fired, r)
+		}
+	}
+	sort.SliceStable(fired, func(i, j int) bool { return severityRank(fired[i].Severity) < severityRank(fired[j].Severity) })
+	return fired
+}
+
+// conditionsText renders fired results as alert lines, e.g.
+// "[HIGH] count service=api: 73 matches (threshold > 50)"
+func conditionsText(fired []ConditionResult) string {
+	var b strings.Builder
+	for _, r := range fired {
+		b.WriteString("- [" + strings.ToUpper(r.Severity) + "] " + r.Type)
+		if r.GroupBy != "" {
+			b.WriteString(" " + r.GroupBy + "=" + r.Group)
+		}
+		b.WriteString(": " + r.Summary + "\n")
+	}
+	return b.String()
+}
+
+// formatCount renders a count without a trailing .0
+func formatCount(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
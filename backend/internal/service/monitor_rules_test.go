@@ -0,0 +1,164 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	cases := []struct {
+		name string
+		cond MonitorCondition
+		cur  map[string]float64
+		prev map[string]float64
+		// want lists the returned results as "group=value fired|quiet"
+		want []string
+	}{
+		{
+			name: "count over threshold",
+			cond: MonitorCondition{Type: ConditionCount, Threshold: 50},
+			cur:  map[string]float64{"": 51},
+			want: []string{"=51 fired"},
+		},
+		{
+			name: "count at threshold does not fire",
+			cond: MonitorCondition{Type: ConditionCount, Threshold: 50},
+			cur:  map[string]float64{"": 50},
+			want: []string{"=50 quiet"},
+		},
+		{
+			name: "count without matches",
+			cond: MonitorCondition{Type: ConditionCount, Threshold: 0},
+			cur:  map[string]float64{},
+			want: []string{"=0 quiet"},
+		},
+		{
+			name: "count per group returns every fired group",
+			cond: MonitorCondition{Type: ConditionCount, Threshold: 50, GroupBy: "service"},
+			cur:  map[string]float64{"api": 73, "web": 12, "worker": 60},
+			want: []string{"api=73 fired", "worker=60 fired"},
+		},
+		{
+			name: "count per group keeps the closest group when none fire",
+			cond: MonitorCondition{Type: ConditionCount, Threshold: 50, GroupBy: "service"},
+			cur:  map[string]float64{"api": 10, "web": 40, "worker": 3},
+			want: []string{"web=40 quiet"},
+		},
+		{
+			name: "increase over threshold",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: 50},
+			cur:  map[string]float64{"": 20},
+			prev: map[string]float64{"": 10},
+			want: []string{"=20 fired"},
+		},
+		{
+			name: "increase below threshold",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: 50},
+			cur:  map[string]float64{"": 14},
+			prev: map[string]float64{"": 10},
+			want: []string{"=14 quiet"},
+		},
+		{
+			name: "increase below min count",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: 50, MinCount: 5},
+			cur:  map[string]float64{"": 3},
+			prev: map[string]float64{"": 1},
+			want: []string{"=3 quiet"},
+		},
+		{
+			name: "burst without baseline counts as increase",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: 50, MinCount: 5},
+			cur:  map[string]float64{"": 8},
+			prev: map[string]float64{},
+			want: []string{"=8 fired"},
+		},
+		{
+			name: "negative threshold fires on a drop",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: -50},
+			cur:  map[string]float64{"": 40},
+			prev: map[string]float64{"": 100},
+			want: []string{"=40 fired"},
+		},
+		{
+			name: "negative threshold ignores an increase",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: -50},
+			cur:  map[string]float64{"": 150},
+			prev: map[string]float64{"": 100},
+			want: []string{"=150 quiet"},
+		},
+		{
+			name: "negative threshold never fires without baseline",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: -50},
+			cur:  map[string]float64{"": 5},
+			prev: map[string]float64{},
+			want: []string{"=5 quiet"},
+		},
+		{
+			name: "drop min count applies to the previous window",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: -50, MinCount: 10},
+			cur:  map[string]float64{"": 1},
+			prev: map[string]float64{"": 4},
+			want: []string{"=1 quiet"},
+		},
+		{
+			name: "drop per group includes groups that went quiet",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: -50, GroupBy: "service"},
+			cur:  map[string]float64{"web": 100},
+			prev: map[string]float64{"api": 20, "web": 90},
+			want: []string{"api=0 fired"},
+		},
+		{
+			name: "increase per group ignores groups that went quiet",
+			cond: MonitorCondition{Type: ConditionChange, Threshold: 50, GroupBy: "service"},
+			cur:  map[string]float64{"web": 100},
+			prev: map[string]float64{"api": 20, "web": 90},
+			want: []string{"web=100 quiet"},
+		},
+		{
+			name: "absence fires at threshold",
+			cond: MonitorCondition{Type: ConditionAbsence, Threshold: 0},
+			cur:  map[string]float64{},
+			want: []string{"=0 fired"},
+		},
+		{
+			name: "absence with matches",
+			cond: MonitorCondition{Type: ConditionAbsence, Threshold: 2},
+			cur:  map[string]float64{"": 3},
+			want: []string{"=3 quiet"},
+		},
+		{
+			name: "absence per group fires for groups that went quiet",
+			cond: MonitorCondition{Type: ConditionAbsence, Threshold: 0, GroupBy: "host"},
+			cur:  map[string]float64{"a": 12},
+			prev: map[string]float64{"a": 10, "b": 7},
+			want: []string{"b=0 fired"},
+		},
+		{
+			name: "absence per group keeps the quietest group when none fire",
+			cond: MonitorCondition{Type: ConditionAbsence, Threshold: 1, GroupBy: "host"},
+			cur:  map[string]float64{"a": 12, "b": 2},
+			prev: map[string]float64{"a": 10, "b": 7},
+			want: []string{"b=2 quiet"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			results := evaluateCondition(3, tc.cond, tc.cur, tc.prev)
+			got := make([]string, 0, len(results))
+			for _, r := range results {
+				state := "quiet"
+				if r.Fired {
+					state = "fired"
+				}
+				got = append(got, fmt.Sprintf("%s=%s %s", r.Group, formatCount(r.Value), state))
+				if r.Index != 3 || r.Type != tc.cond.Type || r.GroupBy != tc.cond.GroupBy || r.Summary == "" {
+					t.Errorf("result %+v does not describe the condition", r)
+				}
+			}
+			if strings.Join(got, ", ") != strings.Join(tc.want, ", ") {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -26,9 +27,7 @@ type MonitorService struct {
 
 func NewMonitorService() *MonitorService {
 	// Standard cron parser with support for seconds
-	c := cron.New(cron.WithParser(cron.NewParser(
-		cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
-	)))
+	c := cron.New(cron.WithParser(cronParser))
 	c.Start()
 
 	ms := &MonitorService{
@@ -39,6 +38,11 @@ func NewMonitorService() *MonitorService {
 		jobMap:        make(map[uint]cron.EntryID),
 	}
 
+	// Escalate unacknowledged alerts independently of the monitor schedules
+	if _, err := c.AddFunc(escalationSchedule, ms.escalateAlerts); err != nil {
+		utils.GetLogger().Error("failed to start alert escalation", zap.Error(err))
+	}
+
 	// Load active monitors on startup
 	go ms.loadJobs()
 
@@ -96,7 +100,23 @@ func (s *MonitorService) RemoveJob(id uint) {
 	}
 }
 
-// ExecuteMonitor is the core logic: Query -> Filter -> AI -> Notify
+// Monitor run statuses
+const (
+	RunRunning = "running"
+	RunNoMatch = "no_match"
+	RunOK      = "ok" // conditions evaluated, none fired
+	RunAlerted = "alerted"
+	RunFailed  = "failed"
+	// RunSuppressed means alerts matched but were already notified, acknowledged or silenced
+	RunSuppressed = "suppressed"
+)
+
+// monitorRunRetention is how long run records are kept
+const monitorRunRetention = 30 * 24 * time.Hour
+
+// ExecuteMonitor is the core logic: Query -> Filter -> Conditions -> AI -> Notify.
+// Every execution is recorded as a MonitorRun, including the ones that found
+// nothing. Monitors without conditions fire on any match.
 func (s *MonitorService) ExecuteMonitor(monitorID uint) {
 	utils.GetLogger().Info("monitor job started", zap.Uint("monitor_id", monitorID))
 
@@ -106,118 +126,249 @@ func (s *MonitorService) ExecuteMonitor(monitorID uint) {
 		return
 	}
 
-	// 1. Determine Time Range (based on last run or cron interval?)
-	// Simplification: query last 1 hour, or parse cron interval?
-	// For "Smart Monitoring", usually we look back 'interval' amount of time.
-	// But parsing cron to interval is hard.
-	// Let's assume we look back 1 hour by default, or maybe making it configurable?
-	// Let's try to infer from cron if it starts with "@every"? No.
-	// Hardcode lookback to 1h for now, or use a new field `Lookback` in model?
-	// Using 1h as reasonable default for periodic checks.
+	// 1. Determine Time Range: the explicit lookback, or the time since the
+	// previous window so runs neither overlap nor leave gaps
 	now := time.Now()
-	start := now.Add(-1 * time.Hour)
-	end := now
+	start, end, winErr := monitorWindow(&m, now)
+
+	run := &model.MonitorRun{MonitorID: m.ID, StartedAt: now, Status: RunRunning, RangeStart: start, RangeEnd: end}
+	if err := database.GetDB().Create(run).Error; err != nil {
+		utils.GetLogger().Error("failed to record monitor run", zap.Uint("id", m.ID), zap.Error(err))
+	}
+	// evaluated is set once the window has been queried; only then does the
+	// next window start after this one
+	evaluated := false
+	defer func() { s.finishRun(run, evaluated) }()
+	if winErr != nil {
+		utils.GetLogger().Error("invalid monitor schedule", zap.Uint("id", m.ID), zap.Error(winErr))
+		run.Status, run.Error = RunFailed, winErr.Error()
+		return
+	}
 
 	startNs := fmt.Sprintf("%d", start.UnixNano())
 	endNs := fmt.Sprintf("%d", end.UnixNano())
 
 	// 2. Query Logs
-	// Need to check keywords?
-	// If Engine is ES/Loki, keywords can be part of query.
-	// If Engine is VL, same.
-	// We append keywords to base query.
-
+	// The user puts base filters in 'Query' (engine syntax); the saved filter
+	// and the keywords (OR'ed text search) are compiled per engine, so
+	// keywords are escaped correctly for LogQL, LogsQL and ES.
 	baseQuery := m.Query
-	if baseQuery == "" {
-		baseQuery = "*" // or empty
-	}
-
-	// Construct effective query with keywords
-	effectiveQuery := baseQuery
-	keywords := strings.Split(m.Keywords, ",")
-	validKeywords := []string{}
-	for _, k := range keywords {
-		k = strings.TrimSpace(k)
-		if k != "" {
-			validKeywords = append(validKeywords, k)
-		}
+	if baseQuery == "" && m.Engine != "loki" {
+		baseQuery = "*"
 	}
 
-	// Appending keywords depends on engine syntax
-	// Simple approach: perform query "*" then filter in memory?
-	// OR: construct query.
-	// Loki: {app="foo"} |= "error"
-	// ES: app:foo AND (error OR warning)
-	// VL: app="foo" (error OR warning)
-
-	// Let's assume user puts base filters in 'Query' and we append keywords as OR condition text search
-	if len(validKeywords) > 0 {
-		orClause := strings.Join(validKeywords, "|") // Regex style for Loki?
-		if m.Engine == "loki" {
-			// Loki: ... |~ "k1|k2"
-			effectiveQuery = fmt.Sprintf("%s |~ \"%s\"", baseQuery, orClause)
-		} else if m.Engine == "elasticsearch" {
-			// ES: ... AND (k1 OR k2)
-			orClauseES := strings.Join(validKeywords, " OR ")
-			if baseQuery == "*" {
-				effectiveQuery = fmt.Sprintf("(%s)", orClauseES)
-			} else {
-				effectiveQuery = fmt.Sprintf("(%s) AND (%s)", baseQuery, orClauseES)
-			}
-		} else if m.Engine == "victorialogs" {
-			// VL: ... (k1 or k2)
-			orClauseVL := strings.Join(validKeywords, " or ")
-			if baseQuery == "" || baseQuery == "*" {
-				effectiveQuery = fmt.Sprintf("(%s)", orClauseVL)
-			} else {
-				effectiveQuery = fmt.Sprintf("%s (%s)", baseQuery, orClauseVL)
-			}
+	filter := &Filter{}
+	if strings.TrimSpace(m.Filter) != "" {
+		if err := json.Unmarshal([]byte(m.Filter), filter); err != nil {
+			utils.GetLogger().Error("invalid monitor filter", zap.Uint("id", m.ID), zap.Error(err))
+			run.Status, run.Error = RunFailed, "invalid filter: "+err.Error()
+			return
 		}
 	}
-
-	result, err := s.logService.ExecuteQuery(context.Background(), m.Engine, m.DatasourceID, effectiveQuery, startNs, endNs, 100) // limit 100 for analysis
+	keywords := FilterNode{Op: FilterOr}
+	for _, k := range strings.Split(m.Keywords, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords.Children = append(keywords.Children, FilterNode{Op: FilterContains, Value: k})
+		}
+	}
+	if len(keywords.Children) > 0 {
+		filter.And(keywords)
+	}
+	conditions, err := ParseConditions(m.Conditions, m.Engine)
 	if err != nil {
-		utils.GetLogger().Error("monitor query failed", zap.Uint("id", m.ID), zap.Error(err))
+		utils.GetLogger().Error("invalid monitor conditions", zap.Uint("id", m.ID), zap.Error(err))
+		run.Status, run.Error = RunFailed, err.Error()
 		return
 	}
 
-	if len(result.Items) == 0 {
+	req := QueryRequest{
+		Query:  baseQuery,
+		Filter: filter,
+		Start:  startNs,
+		End:    endNs,
+		Limit:  100, // limit 100 for analysis
+	}
+	run.Query = baseQuery
+	if q, err := s.logService.EffectiveQuery(m.Engine, m.DatasourceID, req); err == nil {
+		run.Query = q
+	}
+
+	// 3. Conditions: count the window and decide whether to alert at all
+	var fired []ConditionResult
+	if len(conditions) > 0 {
+		results, total, err := s.evaluateConditions(context.Background(), m.Engine, m.DatasourceID, conditions, req)
+		if err != nil {
+			utils.GetLogger().Error("monitor condition evaluation failed", zap.Uint("id", m.ID), zap.Error(err))
+			run.Status, run.Error = RunFailed, "count failed: "+err.Error()
+			return
+		}
+		b, _ := json.Marshal(results)
+		run.Matches, run.Conditions = total, string(b)
+		evaluated = true
+		fired = firedConditions(results)
+	}
+
+	var rows []map[string]interface{}
+	if len(conditions) == 0 || len(fired) > 0 {
+		result, err := s.logService.ExecuteQuery(context.Background(), m.Engine, m.DatasourceID, req)
+		if err != nil {
+			utils.GetLogger().Error("monitor query failed", zap.Uint("id", m.ID), zap.Error(err))
+			run.Status, run.Error = RunFailed, "query failed: "+err.Error()
+			return
+		}
+		evaluated = true
+		rows = result.Items
+		if len(conditions) == 0 {
+			run.Matches = len(rows)
+		}
+	}
+
+	// 4. Alerts: deduplicate against the open alerts of the monitor and
+	// resolve the ones that stopped matching
+	instances := conditionAlerts(&m, fired)
+	if len(conditions) == 0 {
+		instances = patternAlerts(&m, rows)
+	}
+	notify, resolved := s.updateAlerts(&m, run, instances, now)
+	if len(resolved) > 0 {
+		s.sendResolved(&m, run, resolved)
+	}
+	switch {
+	case len(instances) == 0 && len(conditions) > 0:
+		utils.GetLogger().Info("monitor conditions not met", zap.Uint("id", m.ID))
+		run.Status = RunOK
+		return
+	case len(instances) == 0:
 		// No logs found matches keywords
 		utils.GetLogger().Info("monitor found no logs", zap.Uint("id", m.ID))
+		run.Status = RunNoMatch
+		return
+	case len(notify) == 0:
+		// Already notified, acknowledged or silenced
+		utils.GetLogger().Info("monitor alerts suppressed", zap.Uint("id", m.ID), zap.Int("alerts", len(instances)))
+		run.Status = RunSuppressed
 		return
 	}
 
-	// 3. AI Analysis
-	// Convert result items to interface slice
-	logsInterface := make([]interface{}, len(result.Items))
-	for i, v := range result.Items {
-		logsInterface[i] = v
+	// 5. AI Analysis, skipped when nothing matched (e.g. a missing heartbeat)
+	var analysis, severity string
+	if len(rows) > 0 {
+		// Convert result items to interface slice
+		logsInterface := make([]interface{}, len(rows))
+		for i, v := range rows {
+			logsInterface[i] = v
+		}
+
+		dsName := m.DatasourceID
+		if ds, ok := ResolveDatasource(m.Engine, m.DatasourceID); ok {
+			dsName = ds.Model.Name
+		}
+		prompt := fmt.Sprintf("Monitoring Alert: Found %d abnormal logs containing keywords [%s]. Please analyze.", len(rows), m.Keywords)
+		if len(fired) > 0 {
+			prompt = "Monitoring Alert: these alert conditions fired:\n" + conditionsText(fired) + "Please analyze the sample logs."
+		}
+		rec, err := s.aiService.AnalyzeStructured(context.Background(), AnalysisInput{
+			Role:         m.Role,
+			Prompt:       prompt,
+			Logs:         logsInterface,
+			Query:        baseQuery,
+			Datasource:   fmt.Sprintf("%s (%s)", dsName, m.Engine),
+			DatasourceID: m.DatasourceID,
+			TimeRange:    start.Format(time.RFC3339) + " ~ " + end.Format(time.RFC3339),
+		}, 0, m.ID)
+		switch {
+		case err != nil:
+			utils.GetLogger().Error("monitor ai analysis failed", zap.Uint("id", m.ID), zap.Error(err))
+			analysis = "AI Analysis Failed: " + err.Error()
+			run.Error = "analysis failed: " + err.Error()
+		case rec.Analysis != nil:
+			severity = rec.Analysis.Severity
+			analysis = rec.Analysis.Text() + citationsText(rec.Citations) + "\n\n(Model: " + rec.ModelName + ")"
+		default:
+			// The reply could not be validated, send it as is
+			analysis = rec.Raw + "\n\n(Model: " + rec.ModelName + ")"
+		}
+		if rec != nil {
+			run.AnalysisID = rec.ID
+		}
+	}
+	if len(fired) > 0 {
+		// The severity configured on the rules outranks the model's guess
+		severity = highestSeverity(notify)
+	} else if severity != "" {
+		// Pattern alerts take the analysed severity, which routes them
+		ids := make([]uint, len(notify))
+		for i := range notify {
+			notify[i].Severity, ids[i] = severity, notify[i].ID
+		}
+		database.GetDB().Model(&model.Alert{}).Where("id IN ?", ids).Update("severity", severity)
 	}
+	run.Severity, run.Analysis = severity, analysis
 
-	analysis, err := s.aiService.Analyze(fmt.Sprintf("Monitoring Alert: Found %d abnormal logs containing keywords [%s]. Please analyze.", len(result.Items), m.Keywords), logsInterface)
+	// 6. Notify every channel routed for the alerts' severities
+	sent, err := s.deliver(&m, notify, func(alerts []model.Alert) (string, string) {
+		title := fmt.Sprintf("Smart Alert: %s", m.Name)
+		if sev := highestSeverity(alerts); sev != "" {
+			title = fmt.Sprintf("Smart Alert [%s]: %s", strings.ToUpper(sev), m.Name)
+		}
+		content := fmt.Sprintf("Monitor: %s\nTime: %s\nMatches: %d\nKeywords: %s\n", m.Name, time.Now().Format(time.RFC3339), run.Matches, m.Keywords)
+		content += "\nAlerts:\n" + alertsText(alerts, now)
+		if analysis != "" {
+			content += "\nAI Analysis:\n" + analysis
+		}
+		return title, content
+	})
 	if err != nil {
-		utils.GetLogger().Error("monitor ai analysis failed", zap.Uint("id", m.ID), zap.Error(err))
-		analysis = "AI Analysis Failed: " + err.Error()
+		utils.GetLogger().Error("monitor notification failed", zap.Uint("id", m.ID), zap.Error(err))
+		run.NotifyError = err.Error()
 	}
-
-	// 4. Notify
-	var channel model.NotificationChannel
-	if err := database.GetDB().First(&channel, m.ChannelID).Error; err != nil {
-		utils.GetLogger().Error("monitor channel not found", zap.Uint("id", m.ID), zap.Uint("channel_id", m.ChannelID))
+	if sent == 0 {
+		run.Status = RunFailed
 		return
 	}
+	markNotified(notify, time.Now())
+	utils.GetLogger().Info("monitor alert sent", zap.Uint("id", m.ID), zap.Int("channels", sent))
+	run.Status, run.Notified = RunAlerted, true
+}
 
-	title := fmt.Sprintf("Smart Alert: %s", m.Name)
-	content := fmt.Sprintf("Monitor: %s\nTime: %s\nMatches: %d\nKeywords: %s\n\nAI Analysis:\n%s", m.Name, time.Now().Format(time.RFC3339), len(result.Items), m.Keywords, analysis)
-
-	if err := s.notifyService.SendAlert(&channel, title, content); err != nil {
-		utils.GetLogger().Error("monitor notification failed", zap.Error(err))
-	} else {
-		utils.GetLogger().Info("monitor alert sent", zap.Uint("id", m.ID))
+// sendResolved tells the channels that were notified about the alerts that
+// they have resolved
+func (s *MonitorService) sendResolved(m *model.LogMonitor, run *model.MonitorRun, resolved []model.Alert) {
+	_, err := s.deliver(m, resolved, func(alerts []model.Alert) (string, string) {
+		title := fmt.Sprintf("Resolved: %s", m.Name)
+		content := fmt.Sprintf("Monitor: %s\nTime: %s\n\nResolved:\n%s", m.Name, time.Now().Format(time.RFC3339), alertsText(alerts, time.Now()))
+		return title, content
+	})
+	if err != nil {
+		utils.GetLogger().Error("monitor resolved notification failed", zap.Uint("id", m.ID), zap.Error(err))
+		run.NotifyError = "resolved notification: " + err.Error()
 	}
+}
 
-	// Update LastRun
+// finishRun stores the outcome of a run and drops run records past the
+// retention period. When the window was evaluated the monitor's LastRunAt
+// moves to the window end, where the next derived window starts; a window
+// that could not be queried is picked up again by the next run.
+func (s *MonitorService) finishRun(run *model.MonitorRun, evaluated bool) {
 	t := time.Now()
-	m.LastRunAt = &t
-	database.GetDB().Save(&m)
+	run.FinishedAt = &t
+	db := database.GetDB()
+	if err := db.Save(run).Error; err != nil {
+		utils.GetLogger().Error("failed to record monitor run", zap.Uint("id", run.MonitorID), zap.Error(err))
+	}
+	if evaluated {
+		db.Model(&model.LogMonitor{}).Where("id = ?", run.MonitorID).Update("last_run_at", run.RangeEnd)
+	}
+	db.Where("monitor_id = ? AND started_at < ?", run.MonitorID, t.Add(-monitorRunRetention)).Delete(&model.MonitorRun{})
+}
+
+// ListRuns returns the latest runs of a monitor, newest first, optionally of one status
+func (s *MonitorService) ListRuns(monitorID uint, status string, limit int) ([]model.MonitorRun, error) {
+	q := database.GetDB().Where("monitor_id = ?", monitorID).Order("id desc").Limit(chooseInt(limit, 50))
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var items []model.MonitorRun
+	err := q.Find(&items).Error
+	return items, err
 }
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"ailap-backend/internal/model"
+)
+
+// cronParser parses monitor schedules: standard cron with optional seconds
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// maxLookback caps an explicit Lookback
+const maxLookback = 31 * 24 * time.Hour
+
+// defaultIngestDelay is how long before the run a window ends when the
+// monitor does not set IngestDelay; maxIngestDelay caps it
+const (
+	defaultIngestDelay = 30 * time.Second
+	maxIngestDelay     = time.Hour
+)
+
+// ValidateLookback checks an optional lookback duration such as "15m" or "24h"
+func ValidateLookback(lookback string) error {
+	if lookback == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(lookback)
+	if err != nil {
+		return fmt.Errorf("invalid lookback: %v", err)
+	}
+	if d <= 0 || d > maxLookback {
+		return fmt.Errorf("lookback must be between 1s and %s", maxLookback)
+	}
+	return nil
+}
+
+// ValidateIngestDelay checks an optional ingestion delay such as "0s" or "2m"
+func ValidateIngestDelay(delay string) error {
+	if delay == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(delay)
+	if err != nil {
+		return fmt.Errorf("invalid ingest delay: %v", err)
+	}
+	if d < 0 || d > maxIngestDelay {
+		return fmt.Errorf("ingest delay must be between 0s and %s", maxIngestDelay)
+	}
+	return nil
+}
+
+// ingestDelay is the monitor's IngestDelay or the default
+func ingestDelay(m *model.LogMonitor) time.Duration {
+	if d, err := time.ParseDuration(m.IngestDelay); err == nil && d >= 0 {
+		return d
+	}
+	return defaultIngestDelay
+}
+
+// monitorWindow returns the time range a run starting at now queries. The
+// window ends the ingestion delay before now, since logs reach the datasource
+// a little late and would otherwise fall before the next window's start.
+//
+// An explicit Lookback gives a sliding window of that length. Otherwise the
+// window starts where the previous evaluated window ended (LastRunAt), so
+// consecutive runs neither overlap nor leave gaps. On the first run, or when
+// LastRunAt is more than two schedule intervals old (e.g. the monitor was
+// paused), it starts at the schedule's previous fire time instead.
+func monitorWindow(m *model.LogMonitor, now time.Time) (time.Time, time.Time, error) {
+	end := now.Add(-ingestDelay(m))
+	if m.Lookback != "" {
+		d, err := time.ParseDuration(m.Lookback)
+		if err != nil {
+			return end, end, fmt.Errorf("invalid lookback: %v", err)
+		}
+		return end.Add(-d), end, nil
+	}
+	sched, err := cronParser.Parse(m.Cron)
+	if err != nil {
+		return end, end, fmt.Errorf("invalid cron: %v", err)
+	}
+	interval := scheduleInterval(sched, now)
+	if m.LastRunAt != nil && m.LastRunAt.Before(end) && end.Sub(*m.LastRunAt) <= 2*interval {
+		return *m.LastRunAt, end, nil
+	}
+	return end.Add(-interval), end, nil
+}
+
+// scheduleInterval is the time between the fire at or just before now and the
+// fire before it, i.e. how much a run has to look back to reach the previous run
+func scheduleInterval(sched cron.Schedule, now time.Time) time.Duration {
+	if every, ok := sched.(cron.ConstantDelaySchedule); ok {
+		return every.Delay
+	}
+	// The job fires at a whole second and runs a moment later, so the current
+	// fire is the last one not after now
+	current, ok := previousFire(sched, now.Add(time.Nanosecond))
+	if !ok {
+		return time.Hour
+	}
+	prev, ok := previousFire(sched, current)
+	if !ok {
+		return time.Hour
+	}
+	return current.Sub(prev)
+}
+
+// previousFire finds the last fire time strictly before t. Schedules only
+// offer Next, so it steps back until a fire falls before t and then walks
+// forward to the last one.
+func previousFire(sched cron.Schedule, t time.Time) (time.Time, bool) {
+	for back := time.Minute; back <= 366*24*time.Hour; back *= 2 {
+		fire := sched.Next(t.Add(-back))
+		if fire.IsZero() || !fire.Before(t) {
+			continue
+		}
+		for next := sched.Next(fire); !next.IsZero() && next.Before(t); next = sched.Next(next) {
+			fire = next
+		}
+		return fire, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ailap-backend/internal/model"
+)
+
+func TestMonitorWindow(t *testing.T) {
+	// A run fires on a whole minute and starts a moment later
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local).Add(150 * time.Millisecond)
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+	cases := []struct {
+		name      string
+		monitor   model.LogMonitor
+		wantStart time.Duration // how long before now the window starts
+		wantEnd   time.Duration // how long before now the window ends
+		wantErr   bool
+	}{
+		{
+			name:      "every schedule first run",
+			monitor:   model.LogMonitor{Cron: "@every 5m", IngestDelay: "0s"},
+			wantStart: 5 * time.Minute,
+		},
+		{
+			name:      "five field cron first run",
+			monitor:   model.LogMonitor{Cron: "*/10 * * * *", IngestDelay: "0s"},
+			wantStart: 10 * time.Minute,
+		},
+		{
+			name:      "six field cron first run",
+			monitor:   model.LogMonitor{Cron: "0 */15 * * * *", IngestDelay: "0s"},
+			wantStart: 15 * time.Minute,
+		},
+		{
+			name:      "daily cron first run",
+			monitor:   model.LogMonitor{Cron: "0 9 * * *", IngestDelay: "0s"},
+			wantStart: 24 * time.Hour,
+		},
+		{
+			name:      "continues from the last run",
+			monitor:   model.LogMonitor{Cron: "@every 5m", IngestDelay: "0s", LastRunAt: ago(7 * time.Minute)},
+			wantStart: 7 * time.Minute,
+		},
+		{
+			name:      "stale last run falls back to the schedule",
+			monitor:   model.LogMonitor{Cron: "*/10 * * * *", IngestDelay: "0s", LastRunAt: ago(3 * time.Hour)},
+			wantStart: 10 * time.Minute,
+		},
+		{
+			name:      "last run after the window end is ignored",
+			monitor:   model.LogMonitor{Cron: "@every 5m", IngestDelay: "1m", LastRunAt: ago(30 * time.Second)},
+			wantStart: 6 * time.Minute,
+			wantEnd:   time.Minute,
+		},
+		{
+			name:      "explicit lookback slides",
+			monitor:   model.LogMonitor{Cron: "@every 5m", Lookback: "1h", IngestDelay: "0s", LastRunAt: ago(5 * time.Minute)},
+			wantStart: time.Hour,
+		},
+		{
+			name:      "default ingest delay",
+			monitor:   model.LogMonitor{Cron: "@every 5m"},
+			wantStart: 5*time.Minute + defaultIngestDelay,
+			wantEnd:   defaultIngestDelay,
+		},
+		{
+			name:      "ingest delay shifts the window",
+			monitor:   model.LogMonitor{Cron: "@every 5m", Lookback: "15m", IngestDelay: "2m"},
+			wantStart: 17 * time.Minute,
+			wantEnd:   2 * time.Minute,
+		},
+		{
+			name:      "ingest delay keeps the last run as start",
+			monitor:   model.LogMonitor{Cron: "@every 5m", IngestDelay: "2m", LastRunAt: ago(7 * time.Minute)},
+			wantStart: 7 * time.Minute,
+			wantEnd:   2 * time.Minute,
+		},
+		{
+			name:    "invalid cron",
+			monitor: model.LogMonitor{Cron: "every five minutes"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid lookback",
+			monitor: model.LogMonitor{Cron: "@every 5m", Lookback: "an hour"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			start, end, err := monitorWindow(&tc.monitor, now)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := now.Sub(start); got != tc.wantStart {
+				t.Errorf("start %s before now, want %s", got, tc.wantStart)
+			}
+			if got := now.Sub(end); got != tc.wantEnd {
+				t.Errorf("end %s before now, want %s", got, tc.wantEnd)
+			}
+		})
+	}
+}
@@ -1,7 +1,120 @@
 import request from './request'
+import { sseProgress } from './sse'
 
 export function analyzeLogs(payload, config = {}) {
   return request.post('/ai/analyze-logs', payload, { timeout: 60000, ...config })
 }
 
 
+
+// analyzeLogsStream streams the analysis; onEvent receives "delta", "done" and "error" events
+export function analyzeLogsStream(payload, onEvent, config = {}) {
+  return request.post('/ai/analyze-logs/stream', payload, {
+    timeout: 0,
+    responseType: 'text',
+    onDownloadProgress: sseProgress(onEvent),
+    ...config,
+  })
+}
+
+export function analyzeLogsStructured(payload, config = {}) {
+  return request.post('/ai/analyze-logs/structured', payload, { timeout: 180000, ...config })
+}
+
+export function listAnalyses(params = {}) {
+  return request.get('/ai/analyses', { params })
+}
+
+export function getAnalysis(id) {
+  return request.get(`/ai/analyses/${id}`)
+}
+
+export function generateQuery(payload, config = {}) {
+  return request.post('/ai/generate-query', payload, { timeout: 90000, ...config })
+}
+
+export function resolveAnalysis(id, resolution) {
+  return request.post(`/ai/analyses/${id}/resolve`, { resolution })
+}
+
+export function listKnowledge(params) {
+  return request.get('/ai/knowledge', { params })
+}
+
+export function getKnowledge(id) {
+  return request.get(`/ai/knowledge/${id}`)
+}
+
+export function createKnowledge(data) {
+  return request.post('/ai/knowledge', data)
+}
+
+export function uploadKnowledge(file) {
+  const form = new FormData()
+  form.append('file', file)
+  return request.post('/ai/knowledge', form)
+}
+
+export function updateKnowledge(id, data) {
+  return request.put(`/ai/knowledge/${id}`, data)
+}
+
+export function deleteKnowledge(id) {
+  return request.delete(`/ai/knowledge/${id}`)
+}
+
+export function searchKnowledge(q) {
+  return request.get('/ai/knowledge/search', { params: { q } })
+}
+
+export function listRoles() {
+  return request.get('/ai/roles')
+}
+
+export function listConversations() {
+  return request.get('/ai/conversations')
+}
+
+export function getConversation(id) {
+  return request.get(`/ai/conversations/${id}`)
+}
+
+export function renameConversation(id, title) {
+  return request.put(`/ai/conversations/${id}`, { title })
+}
+
+export function deleteConversation(id) {
+  return request.delete(`/ai/conversations/${id}`)
+}
+
+export function usageSummary(params) {
+  return request.get('/ai/usage/summary', { params })
+}
+
+export function listUsage(params) {
+  return request.get('/ai/usage', { params })
+}
+
+export function listRedactions(params) {
+  return request.get('/ai/redactions', { params })
+}
+
+export function previewRedaction(data) {
+  return request.post('/ai/redact/preview', data)
+}
+
+export function listBudgets() {
+  return request.get('/ai/budgets')
+}
+
+export function createBudget(data) {
+  return request.post('/ai/budgets', data)
+}
+
+export function updateBudget(id, data) {
+  return request.put(`/ai/budgets/${id}`, data)
+}
+
+export function deleteBudget(id) {
+  return request.delete(`/ai/budgets/${id}`)
+}
@@ -1,9 +1,34 @@
 import request from './request'
+import { sseProgress } from './sse'
 
 export function queryLogs(params) {
   return request.get('/logs/query', { params })
 }
 
+// tailLogs streams new entries over SSE; onEvent(event, data) is called for each
+// "logs" / "error" event. Pass config.signal (AbortController) to stop tailing.
+export function tailLogs(params, onEvent, config = {}) {
+  return request.get('/logs/tail', {
+    params,
+    timeout: 0,
+    responseType: 'text',
+    onDownloadProgress: sseProgress(onEvent),
+    ...config,
+  })
+}
+
+export function federatedQuery(payload) {
+  return request.post('/logs/federated', payload, { timeout: 60000 })
+}
+
+export function logVolume(params) {
+  return request.get('/logs/volume', { params })
+}
+
+export function logPatterns(params) {
+  return request.get('/logs/patterns', { params, timeout: 60000 })
+}
+
 export function suggestions(params) {
   return request.get('/logs/suggestions', { params })
 }
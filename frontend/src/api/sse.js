@@ -0,0 +1,25 @@
+// sseProgress returns an axios onDownloadProgress handler that parses the
+// server-sent events received so far and calls onEvent(event, data) for each
+// complete event with a JSON data payload.
+export function sseProgress(onEvent) {
+  let offset = 0
+  return (evt) => {
+    const text = evt.event?.target?.responseText || ''
+    const end = text.lastIndexOf('\n\n')
+    if (end < offset) return
+    const blocks = text.slice(offset, end).split('\n\n')
+    offset = end + 2
+    blocks.forEach((block) => {
+      let event = 'message'
+      const data = []
+      block.split('\n').forEach((line) => {
+        if (line.startsWith('event:')) event = line.slice(6).trim()
+        else if (line.startsWith('data:')) data.push(line.slice(5))
+      })
+      if (!data.length) return
+      try {
+        onEvent(event, JSON.parse(data.join('\n')))
+      } catch (_) {}
+    })
+  }
+}
@@ -6,6 +6,8 @@ export default {
         datasources: 'Data Sources',
         monitors: 'Smart Monitoring',
         channels: 'Channels',
+        knowledge: 'Knowledge Base',
+        alerts: 'Alerts',
     },
     common: {
         edit: 'Edit',
@@ -46,6 +48,12 @@ export default {
         advanced: 'Advanced',
         dataLinks: 'Data Links',
         derivedFields: 'Derived Fields',
+        redaction: 'Sensitive Data Redaction',
+        redactionHint: 'Emails, phone numbers, ID cards, IPs, JWTs, API keys and card numbers are always replaced with tokens before logs are sent to AI models. Add regex rules for data specific to this datasource.',
+        redactionName: 'Name, e.g. tenant',
+        redactionPattern: 'Regex, e.g. tenant-\\w+',
+        redactionSample: 'Paste a sample log line to preview',
+        redactionPreview: 'Preview',
         index: 'Index',
         pattern: 'Pattern',
         timeField: 'Time Field',
@@ -77,6 +85,15 @@ export default {
         sysPrompt: 'System Prompt',
         temp: 'Temperature',
         maxTokens: 'Max Tokens',
+        contextTokens: 'Context Window (tokens, 0 = auto)',
+        roleLanguage: 'Answer language',
+        roleOutputFormat: 'Output format',
+        promptVars: 'Template variables: {vars}; logs are appended when .Logs is not used',
+        fallbackOrder: 'Fallback Order (0 = not in chain)',
+        timeoutSeconds: 'Timeout (seconds, 0 = 60)',
+        maxRetries: 'Retries on 429/5xx (0 = 2, -1 = off)',
+        promptPrice: 'Price per 1M prompt tokens (0 = free)',
+        completionPrice: 'Price per 1M completion tokens (0 = free)',
         apiBase: 'API Base',
         apiKeyPlaceholder: 'Enter API Key',
 
@@ -143,6 +160,23 @@ export default {
         prevPage: 'Prev',
         nextPage: 'Next',
         pageInfo: 'Page {current} / {total} ({count} items)',
+        loadMore: 'Load more',
+        volumeTitle: 'Log volume ({count} lines)',
+        liveTail: 'Live',
+        stopTail: 'Stop',
+        liveTailHelp: 'Stream new entries of the last query as they arrive',
+        federated: 'Multiple datasources',
+        federatedHelp: 'Search several datasources at once; results are merged newest first',
+        addSource: 'Add datasource',
+        selectSources: 'Please pick a datasource and query for at least one row',
+        sourceFailed: '{name} failed: {error}',
+        logsView: 'Logs',
+        patternsView: 'Patterns',
+        patternResults: '{count} patterns from {rows} lines',
+        pattern: 'Pattern',
+        patternCount: 'Count',
+        patternLevels: 'Levels',
+        patternLastSeen: 'Last seen',
         searchHistory: 'Search history...',
         historyTitle: 'Recent',
         favoriteTitle: 'Favorites',
@@ -187,6 +221,9 @@ export default {
         selectValue: 'Select Value',
     },
     monitor: {
+        role: 'Analysis Role',
+        placeRole: 'Built-in role',
+        helpRole: 'Persona and prompt template used for the AI analysis of alerts',
         title: 'Smart Monitoring',
         newTask: 'New Task',
         editTask: 'Edit Task',
@@ -210,6 +247,45 @@ export default {
         subtitle: 'Manage Automated Monitoring',
         newSubtitle: 'Create New Task',
         editSubtitle: 'Edit Task Config',
+        lookback: 'Lookback',
+        placeLookback: 'Derived from schedule',
+        helpLookback: 'Time window each run queries, e.g. 15m or 24h. Leave empty to query exactly the time since the previous run, so windows never overlap or leave gaps',
+        ingestDelay: 'Ingestion Delay',
+        helpIngestDelay: 'Each window ends this long before the run, so logs that reach the data source late are still evaluated, e.g. 1m. Default 30s, 0s to disable',
+        renotifyInterval: 'Re-notify Interval',
+        helpRenotify: 'A firing alert is sent again after this long unless acknowledged or silenced. Default 4h',
+        conditions: 'Alert Conditions',
+        helpConditions: 'Without conditions any match alerts. Count: more than N matches; change: % change vs the previous window (negative for drops, min count avoids noise); absence: N or fewer matches (heartbeat). Group by evaluates per label value, e.g. service',
+        condCount: 'Count >',
+        condChange: 'Change %',
+        condAbsence: 'Absence',
+        threshold: 'Threshold',
+        minCount: 'Min count',
+        groupBy: 'Group by',
+        addCondition: 'Add condition',
+        routes: 'Notification Routes',
+        helpRoutes: 'Each route sends alerts of the chosen severities (all when empty) to a channel. A route with an escalation delay only notifies when the alert is still unacknowledged that many minutes after the first notification',
+        allSeverities: 'All severities',
+        escalateAfter: 'Escalate after',
+        addRoute: 'Add route',
+        runs: 'Runs',
+        runStarted: 'Started',
+        runDuration: 'Duration',
+        matches: 'Matches',
+        severity: 'Severity',
+        notified: 'Notified',
+        window: 'Time window',
+        effectiveQuery: 'Effective query',
+        runError: 'Error',
+        analysis: 'AI analysis',
+        runStatus: {
+            running: 'Running',
+            ok: 'Not triggered',
+            no_match: 'No match',
+            alerted: 'Alerted',
+            suppressed: 'Suppressed',
+            failed: 'Failed',
+        },
     },
     channel: {
         title: 'Notification Channels',
@@ -235,6 +311,7 @@ export default {
         title: 'Models',
     },
     chat: {
+        role: 'Role',
         tooltip: 'AI Smart Analysis',
         title: 'AI Log Analysis Assistant',
         intro: 'Hello! I am your log analysis assistant.',
@@ -242,12 +319,22 @@ export default {
         actionAnomaly: 'Analyze Anomalies',
         actionSummary: 'Summarize',
         actionError: 'Extract Errors',
+        actionStructured: 'Structured Analysis',
+        rootCause: 'Root cause:',
+        affectedServices: 'Affected:',
+        evidence: 'Evidence:',
+        actions: 'Actions:',
         promptAnomaly: 'Please analyze anomalies in these logs',
         promptSummary: 'Summarize the main content of these logs',
         promptError: 'Extract key error information from these logs',
         cancel: 'Analysis canceled',
         placeholder: 'Type your question...',
         loading: 'Analyzing...',
+        references: 'References',
+        markResolved: 'Mark resolved',
+        resolved: 'Resolved',
+        resolutionPlaceholder: 'How was the incident fixed? The analysis and this resolution are saved to the knowledge base.',
+        resolvedSaved: 'Saved to knowledge base',
     },
     login: {
         title: 'AILAP Intelligent Analysis',
@@ -275,4 +362,53 @@ export default {
         reset: 'Reset',
         subtitle: 'Account & Security',
     },
+    knowledge: {
+        subtitle: 'Runbooks and past incidents used to ground AI analysis',
+        newDoc: 'New Document',
+        editDoc: 'Edit Document',
+        upload: 'Upload Markdown',
+        uploaded: 'Document uploaded',
+        docTitle: 'Title',
+        content: 'Content',
+        contentPlaceholder: 'Markdown; headings split the document into searchable sections',
+        source: 'Source',
+        all: 'All',
+        sourceUpload: 'Runbook',
+        sourceAnalysis: 'Incident',
+        chunks: 'Sections',
+        updatedAt: 'Updated',
+        searchPlaceholder: 'Test retrieval, e.g. connection pool exhausted',
+        noHits: 'No matching sections',
+    },
+    alert: {
+        subtitle: 'Deduplicated alerts and silences',
+        monitor: 'Monitor',
+        alerts: 'Alerts',
+        silences: 'Silences',
+        all: 'All',
+        status: {
+            firing: 'Firing',
+            acknowledged: 'Acknowledged',
+            resolved: 'Resolved',
+        },
+        silenced: 'Silenced',
+        summary: 'Summary',
+        startsAt: 'Starts',
+        endsAt: 'Ends',
+        lastSeen: 'Last Seen',
+        notifyCount: 'Notifications',
+        ack: 'Acknowledge',
+        acked: 'Alert acknowledged',
+        silence: 'Silence',
+        newSilence: 'New Silence',
+        allMonitors: 'All monitors',
+        matchers: 'Label Matchers',
+        helpMatchers: 'All matchers must match the alert labels; =~ is an anchored regex. Leave empty to silence every alert of the monitor',
+        label: 'Label',
+        value: 'Value',
+        addMatcher: 'Add matcher',
+        timeRange: 'Time range',
+        comment: 'Comment',
+        expire: 'Expire',
+    },
 }
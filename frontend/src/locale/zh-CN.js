@@ -6,6 +6,8 @@ export default {
         datasources: '数据源',
         monitors: '智能监控任务',
         channels: '通知渠道',
+        knowledge: '知识库',
+        alerts: '告警',
     },
     common: {
         edit: '编辑',
@@ -47,6 +49,12 @@ export default {
         advanced: '高级设置',
         dataLinks: '数据链接',
         derivedFields: '派生字段（Derived fields）',
+        redaction: '敏感数据脱敏',
+        redactionHint: '邮箱、手机号、身份证号、IP、JWT、API Key 和银行卡号在发送给 AI 模型前始终会被替换为占位符。可为此数据源添加自定义正则规则。',
+        redactionName: '名称，如 tenant',
+        redactionPattern: '正则，如 tenant-\\w+',
+        redactionSample: '粘贴一行日志样例进行预览',
+        redactionPreview: '预览',
         index: '索引',
         pattern: '模式',
         timeField: '时间字段',
@@ -78,6 +86,15 @@ export default {
         sysPrompt: '系统提示词',
         temp: '温度 (Temperature)',
         maxTokens: '最大生成的 Token 数 (Max Tokens)',
+        contextTokens: '上下文窗口 Token 数 (0 为自动)',
+        roleLanguage: '回答语言',
+        roleOutputFormat: '输出格式',
+        promptVars: '模板变量: {vars}; 未使用 .Logs 时日志附加在末尾',
+        fallbackOrder: '备用顺序 (0 为不参与回退)',
+        timeoutSeconds: '超时秒数 (0 为 60)',
+        maxRetries: '429/5xx 重试次数 (0 为 2, -1 为关闭)',
+        promptPrice: '每百万输入 token 价格 (0 为免费)',
+        completionPrice: '每百万输出 token 价格 (0 为免费)',
         apiBase: 'API Base',
         apiKeyPlaceholder: '请输入 API Key',
 
@@ -170,6 +187,23 @@ export default {
         prevPage: '上一页',
         nextPage: '下一页',
         pageInfo: '第 {current} / {total} 页 (本页 {count} 条)',
+        loadMore: '加载更多',
+        volumeTitle: '日志量 (共 {count} 条)',
+        liveTail: '实时',
+        stopTail: '停止',
+        liveTailHelp: '实时推送上一次查询的新日志',
+        federated: '多数据源',
+        federatedHelp: '同时查询多个数据源，结果按时间倒序合并',
+        addSource: '添加数据源',
+        selectSources: '请至少为一行选择数据源并填写查询语句',
+        sourceFailed: '{name} 查询失败: {error}',
+        logsView: '日志',
+        patternsView: '模式',
+        patternResults: '{rows} 条日志归纳出 {count} 个模式',
+        pattern: '模式',
+        patternCount: '次数',
+        patternLevels: '级别',
+        patternLastSeen: '最近出现',
         searchHistory: '搜索历史记录...',
         historyTitle: '最近查询',
         favoriteTitle: '我的收藏',
@@ -214,6 +248,9 @@ export default {
         selectValue: '选择值',
     },
     monitor: {
+        role: '分析角色',
+        placeRole: '内置角色',
+        helpRole: '告警 AI 分析使用的角色与提示词模板',
         title: '智能监控任务',
         newTask: '新建任务',
         editTask: '编辑任务',
@@ -237,6 +274,45 @@ export default {
         subtitle: '管理自动日志监控任务',
         newSubtitle: '创建新的监控任务',
         editSubtitle: '修改监控任务配置',
+        lookback: '回溯时间',
+        placeLookback: '根据调度自动计算',
+        helpLookback: '每次执行查询的时间窗口，例如 15m、24h。留空则查询自上次执行以来的时间，窗口之间既不重叠也不遗漏',
+        ingestDelay: '采集延迟',
+        helpIngestDelay: '每次查询窗口在执行时间之前这么久结束，以便延迟写入数据源的日志也能被评估，例如 1m。默认 30s，填 0s 关闭',
+        renotifyInterval: '重复通知间隔',
+        helpRenotify: '持续触发的告警在此间隔后再次发送，已确认或静默的除外。默认 4h',
+        conditions: '告警条件',
+        helpConditions: '未设置条件时任何匹配都会告警。数量：匹配数超过 N；变化率：与上一个窗口相比的百分比变化（负数表示下降，最小数量用于过滤噪声）；缺失：匹配数不超过 N（心跳）。分组按标签值分别判断，例如 service',
+        condCount: '数量 >',
+        condChange: '变化率 %',
+        condAbsence: '缺失',
+        threshold: '阈值',
+        minCount: '最小数量',
+        groupBy: '分组字段',
+        addCondition: '添加条件',
+        routes: '通知路由',
+        helpRoutes: '每条路由将所选级别（为空则全部）的告警发送到渠道。设置了升级时间的路由仅在首次通知后该分钟数内告警仍未确认时通知',
+        allSeverities: '全部级别',
+        escalateAfter: '升级时间',
+        addRoute: '添加路由',
+        runs: '执行记录',
+        runStarted: '开始时间',
+        runDuration: '耗时',
+        matches: '匹配数',
+        severity: '严重程度',
+        notified: '已通知',
+        window: '查询时间窗口',
+        effectiveQuery: '实际查询',
+        runError: '错误',
+        analysis: 'AI 分析',
+        runStatus: {
+            running: '执行中',
+            ok: '未触发',
+            no_match: '无匹配',
+            alerted: '已告警',
+            suppressed: '已抑制',
+            failed: '失败',
+        },
     },
     channel: {
         title: '通知渠道',
@@ -262,6 +338,7 @@ export default {
         title: '模型',
     },
     chat: {
+        role: '角色',
         tooltip: 'AI 智能分析',
         title: 'AI 日志分析助手',
         intro: '你好！我是你的日志分析助手。',
@@ -269,11 +346,70 @@ export default {
         actionAnomaly: '分析异常',
         actionSummary: '总结内容',
         actionError: '提取错误',
+        actionStructured: '结构化分析',
+        rootCause: '根因:',
+        affectedServices: '影响服务:',
+        evidence: '证据:',
+        actions: '建议操作:',
         promptAnomaly: '请分析这些日志中的异常情况',
         promptSummary: '总结这些日志的主要内容',
         promptError: '提取这些日志中的关键错误信息',
         cancel: '分析已取消',
         placeholder: '输入你的问题...',
         loading: '正在分析中...',
+        references: '参考资料',
+        markResolved: '标记已解决',
+        resolved: '已解决',
+        resolutionPlaceholder: '问题是如何解决的？分析结果和解决方案将保存到知识库。',
+        resolvedSaved: '已保存到知识库',
+    },
+    knowledge: {
+        subtitle: '用于辅助 AI 分析的运维手册和历史事件',
+        newDoc: '新建文档',
+        editDoc: '编辑文档',
+        upload: '上传 Markdown',
+        uploaded: '文档已上传',
+        docTitle: '标题',
+        content: '内容',
+        contentPlaceholder: 'Markdown 格式，按标题切分为可检索的段落',
+        source: '来源',
+        all: '全部',
+        sourceUpload: '运维手册',
+        sourceAnalysis: '历史事件',
+        chunks: '段落数',
+        updatedAt: '更新时间',
+        searchPlaceholder: '测试检索，例如 连接池耗尽',
+        noHits: '没有匹配的段落',
+    },
+    alert: {
+        subtitle: '去重后的告警与静默规则',
+        monitor: '监控任务',
+        alerts: '告警',
+        silences: '静默',
+        all: '全部',
+        status: {
+            firing: '触发中',
+            acknowledged: '已确认',
+            resolved: '已恢复',
+        },
+        silenced: '已静默',
+        summary: '摘要',
+        startsAt: '开始时间',
+        endsAt: '结束时间',
+        lastSeen: '最近出现',
+        notifyCount: '通知次数',
+        ack: '确认',
+        acked: '告警已确认',
+        silence: '静默',
+        newSilence: '新建静默',
+        allMonitors: '全部监控任务',
+        matchers: '标签匹配',
+        helpMatchers: '所有匹配条件都需满足告警标签；=~ 为完整匹配的正则。留空则静默该监控任务的所有告警',
+        label: '标签',
+        value: '值',
+        addMatcher: '添加匹配条件',
+        timeRange: '时间范围',
+        comment: '备注',
+        expire: '结束静默',
     },
 }
@@ -16,6 +16,8 @@ const MonitorList = () => import('@/pages/monitor/MonitorList.vue')
 const MonitorEdit = () => import('@/pages/monitor/MonitorEdit.vue')
 const ChannelList = () => import('@/pages/monitor/ChannelList.vue')
 const ChannelEdit = () => import('@/pages/monitor/ChannelEdit.vue')
+const AlertList = () => import('@/pages/monitor/AlertList.vue')
+const Knowledge = () => import('@/pages/Knowledge.vue')
 
 const router = createRouter({
   history: createWebHistory(),
@@ -38,9 +40,11 @@ const router = createRouter({
         { path: 'monitors', component: MonitorList, meta: { locale: 'menu.monitors', localeSubtitle: 'monitor.subtitle' } },
         { path: 'monitors/new', component: MonitorEdit, meta: { locale: 'monitor.newTask', localeSubtitle: 'monitor.newSubtitle' } },
         { path: 'monitors/:id', component: MonitorEdit, meta: { locale: 'monitor.editTask', localeSubtitle: 'monitor.editSubtitle' } },
+        { path: 'alerts', component: AlertList, meta: { locale: 'menu.alerts', localeSubtitle: 'alert.subtitle' } },
         { path: 'channels', component: ChannelList, meta: { locale: 'menu.channels', localeSubtitle: 'channel.subtitle' } },
         { path: 'channels/new', component: ChannelEdit, meta: { locale: 'channel.newChannel', localeSubtitle: 'channel.newSubtitle' } },
         { path: 'channels/:id', component: ChannelEdit, meta: { locale: 'channel.editChannel', localeSubtitle: 'channel.editSubtitle' } },
+        { path: 'knowledge', component: Knowledge, meta: { locale: 'menu.knowledge', localeSubtitle: 'knowledge.subtitle' } },
       ],
     },
   ],
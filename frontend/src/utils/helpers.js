@@ -3,19 +3,16 @@ export function formatDate(date) {
   return d.toISOString()
 }
 
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
+// fieldCompletions suggests field names for the token at the end of a query.
+// Each option is the full query with the token completed as "field:".
+export function fieldCompletions(query, fields, max = 20) {
+  const m = /^([\s\S]*?)([\w.@-]*)$/.exec(query || '')
+  const head = m ? m[1] : ''
+  const token = m ? m[2] : ''
+  if (!token) return []
+  const lower = token.toLowerCase()
+  return fields
+    .filter((f) => f.toLowerCase().startsWith(lower) && f !== token)
+    .slice(0, max)
+    .map((f) => head + f + ':')
+}